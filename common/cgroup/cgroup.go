@@ -37,13 +37,77 @@ var (
 	isolatorFuncs = map[string]addIsolatorFunc{
 		"cpu":    addCpuLimit,
 		"memory": addMemoryLimit,
+		"pids":   addPidsLimit,
 	}
 	cgroupControllerRWFiles = map[string][]string{
-		"memory": []string{"memory.limit_in_bytes"},
-		"cpu":    []string{"cpu.cfs_quota_us"},
+		"memory":  []string{"memory.limit_in_bytes"},
+		"cpu":     []string{"cpu.cfs_quota_us"},
+		"pids":    []string{"pids.max"},
+		"blkio":   []string{"blkio.weight", "blkio.weight_device", "blkio.throttle.read_bps_device", "blkio.throttle.write_bps_device"},
+		"hugetlb": hugetlbControllerRWFiles(),
+		"devices": []string{"devices.allow", "devices.deny"},
+		"freezer": []string{"freezer.state"},
 	}
 )
 
+// hugePageSizes are the hugetlb page sizes rkt knows how to translate into
+// "hugetlb.<size>.limit_in_bytes" cgroup knobs. Not every kernel exposes all
+// of these; callers should check for file existence before relying on one.
+var hugePageSizes = []string{"2MB", "1GB"}
+
+func hugetlbControllerRWFiles() []string {
+	var files []string
+	for _, sz := range hugePageSizes {
+		files = append(files, fmt.Sprintf("hugetlb.%s.limit_in_bytes", sz))
+	}
+	return files
+}
+
+// hugetlbLimitFile returns the hugetlb knob filename for the given page
+// size, which differs between cgroup v1 ("limit_in_bytes") and v2 ("max").
+func hugetlbLimitFile(pageSize string) (string, error) {
+	mode, err := GetMode()
+	if err != nil {
+		return "", err
+	}
+	if mode == Unified {
+		return fmt.Sprintf("hugetlb.%s.max", pageSize), nil
+	}
+	return fmt.Sprintf("hugetlb.%s.limit_in_bytes", pageSize), nil
+}
+
+// SupportedHugePageSizes probes which of hugePageSizes the running kernel
+// actually exposes a cgroup knob for, since not every kernel build enables
+// every hugetlb page size.
+func SupportedHugePageSizes() []string {
+	hugetlbDir := "/sys/fs/cgroup/hugetlb"
+	if mode, err := GetMode(); err == nil && mode == Unified {
+		hugetlbDir = unifiedMountPoint
+	}
+
+	var supported []string
+	for _, sz := range hugePageSizes {
+		file, err := hugetlbLimitFile(sz)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(hugetlbDir, file)); err == nil {
+			supported = append(supported, sz)
+		}
+	}
+	return supported
+}
+
+// WriteHugetlbLimit writes limit's byte value to the hugetlb knob for
+// pageSize (e.g. "2MB", "1GB") under cgroupPath.
+func WriteHugetlbLimit(cgroupPath, pageSize string, limit *resource.Quantity) error {
+	file, err := hugetlbLimitFile(pageSize)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(cgroupPath, file), []byte(strconv.FormatInt(limit.Value(), 10)), 0644)
+}
+
 func addCpuLimit(opts []*unit.UnitOption, limit *resource.Quantity) ([]*unit.UnitOption, error) {
 	if limit.Value() > resource.MaxMilliValue {
 		return nil, fmt.Errorf("cpu limit exceeds the maximum millivalue: %v", limit.String())
@@ -58,6 +122,71 @@ func addMemoryLimit(opts []*unit.UnitOption, limit *resource.Quantity) ([]*unit.
 	return opts, nil
 }
 
+func addPidsLimit(opts []*unit.UnitOption, limit *resource.Quantity) ([]*unit.UnitOption, error) {
+	opts = append(opts, unit.NewUnitOption("Service", "TasksMax", strconv.Itoa(int(limit.Value()))))
+	return opts, nil
+}
+
+// BlockIODevice describes a per-device blkio limit, keyed by the device's
+// major:minor numbers as found under /sys/dev/block: a weight (translated
+// into blkio.weight_device), read/write bytes-per-second limits (translated
+// into blkio.throttle.{read,write}_bps_device), and read/write IO-operations-
+// per-second limits (translated into blkio.throttle.{read,write}_iops_device).
+type BlockIODevice struct {
+	Major     int    `json:"major"`
+	Minor     int    `json:"minor"`
+	Weight    uint16 `json:"weight,omitempty"`
+	ReadBPS   uint64 `json:"readBPS,omitempty"`
+	WriteBPS  uint64 `json:"writeBPS,omitempty"`
+	ReadIOPS  uint64 `json:"readIOPS,omitempty"`
+	WriteIOPS uint64 `json:"writeIOPS,omitempty"`
+}
+
+// AddBlockIOIsolator extends opts with the systemd blkio/io directives for an
+// overall weight plus any per-device bandwidth, IOPS, or weight limits.
+// BlockIODeviceWeight=/BlockIOReadBandwidth=/BlockIOWriteBandwidth= apply to
+// the legacy blkio controller; IOReadIOPSMax=/IOWriteIOPSMax= apply to the
+// unified hierarchy's io controller, since cgroup v1's blkio.throttle has no
+// systemd unit directive for IOPS limits.
+func AddBlockIOIsolator(opts []*unit.UnitOption, weight uint16, devices []BlockIODevice) ([]*unit.UnitOption, error) {
+	if weight != 0 {
+		opts = append(opts, unit.NewUnitOption("Service", "BlockIOWeight", strconv.Itoa(int(weight))))
+	}
+	for _, d := range devices {
+		devNode := fmt.Sprintf("%d:%d", d.Major, d.Minor)
+		if d.Weight != 0 {
+			opts = append(opts, unit.NewUnitOption("Service", "BlockIODeviceWeight", fmt.Sprintf("%s %d", devNode, d.Weight)))
+		}
+		if d.ReadBPS != 0 {
+			opts = append(opts, unit.NewUnitOption("Service", "BlockIOReadBandwidth", fmt.Sprintf("%s %d", devNode, d.ReadBPS)))
+		}
+		if d.WriteBPS != 0 {
+			opts = append(opts, unit.NewUnitOption("Service", "BlockIOWriteBandwidth", fmt.Sprintf("%s %d", devNode, d.WriteBPS)))
+		}
+		if d.ReadIOPS != 0 {
+			opts = append(opts, unit.NewUnitOption("Service", "IOReadIOPSMax", fmt.Sprintf("%s %d", devNode, d.ReadIOPS)))
+		}
+		if d.WriteIOPS != 0 {
+			opts = append(opts, unit.NewUnitOption("Service", "IOWriteIOPSMax", fmt.Sprintf("%s %d", devNode, d.WriteIOPS)))
+		}
+	}
+	return opts, nil
+}
+
+// AddHugetlbIsolator applies a hugetlb page size limit to cgroupPath. systemd
+// has no unit directive for hugetlb (there's no cgroup controller delegation
+// for it), so unlike the other isolators this one takes no unit options and
+// is applied by writing the cgroup knob directly via WriteHugetlbLimit;
+// AddHugetlbIsolator only adds the "skip with a warning when the controller
+// isn't supported" behavior the other isolators have.
+func AddHugetlbIsolator(cgroupPath, pageSize string, limit *resource.Quantity) error {
+	if !IsIsolatorSupported("hugetlb") {
+		fmt.Fprintf(os.Stderr, "warning: resource/hugetlb isolator set but support disabled in the kernel, skipping\n")
+		return nil
+	}
+	return WriteHugetlbLimit(cgroupPath, pageSize, limit)
+}
+
 // MaybeAddIsolator considers the given isolator; if the type is known
 // (i.e. IsIsolatorSupported is true) and the limit is non-nil, the supplied
 // opts will be extended with an appropriate option implementing the desired
@@ -78,16 +207,35 @@ func MaybeAddIsolator(opts []*unit.UnitOption, isolator string, limit *resource.
 	return opts, nil
 }
 
-// IsIsolatorSupported returns whether an isolator is supported in the kernel
+// IsIsolatorSupported returns whether an isolator is supported in the kernel.
+// On cgroup v1 (or hybrid) hosts, a controller is considered supported as
+// soon as at least one of its associated files exists, since some kernels
+// only expose a subset of an otherwise-enabled controller's knobs (e.g. not
+// every hugetlb page size). On a unified (cgroup v2) host, support instead
+// comes down to whether the controller is listed in cgroup.controllers.
 func IsIsolatorSupported(isolator string) bool {
-	if files, ok := cgroupControllerRWFiles[isolator]; ok {
-		for _, f := range files {
-			isolatorPath := filepath.Join("/sys/fs/cgroup/", isolator, f)
-			if _, err := os.Stat(isolatorPath); os.IsNotExist(err) {
-				return false
+	if mode, err := GetMode(); err == nil && mode == Unified {
+		controllers, err := unifiedControllers()
+		if err != nil {
+			return false
+		}
+		for _, c := range controllers {
+			if c == isolator {
+				return true
 			}
 		}
-		return true
+		return false
+	}
+
+	files, ok := cgroupControllerRWFiles[isolator]
+	if !ok {
+		return false
+	}
+	for _, f := range files {
+		isolatorPath := filepath.Join("/sys/fs/cgroup/", isolator, f)
+		if _, err := os.Stat(isolatorPath); err == nil {
+			return true
+		}
 	}
 	return false
 }
@@ -168,12 +316,24 @@ func parseOwnCgroupController(controller string) ([]string, error) {
 	}
 	defer cg.Close()
 
-	s := bufio.NewScanner(cg)
+	return parseOwnCgroupFile(cg, controller)
+}
+
+// parseOwnCgroupFile parses /proc/self/cgroup lines, either the legacy v1
+// "<hierarchy-id>:<controller-list>:<path>" form or the v2 unified form
+// "0::<path>", where an empty controller list applies to every controller.
+func parseOwnCgroupFile(f io.Reader, controller string) ([]string, error) {
+	s := bufio.NewScanner(f)
 	for s.Scan() {
 		parts := strings.SplitN(s.Text(), ":", 3)
 		if len(parts) < 3 {
 			return nil, fmt.Errorf("error parsing /proc/self/cgroup")
 		}
+		if parts[1] == "" {
+			// cgroup v2 unified hierarchy: the same path applies to
+			// every controller.
+			return parts, nil
+		}
 		controllerParts := strings.Split(parts[1], ",")
 		for _, c := range controllerParts {
 			if c == controller {
@@ -181,6 +341,9 @@ func parseOwnCgroupController(controller string) ([]string, error) {
 			}
 		}
 	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
 
 	return nil, fmt.Errorf("controller %q not found", controller)
 }
@@ -229,6 +392,14 @@ func fixCpusetKnobs(cpusetPath string) {
 // leaves the subcgroup for each app read-write so the systemd inside stage1
 // can apply isolators to them
 func CreateCgroups(root string, subcgroup string, serviceNames []string) error {
+	mode, err := GetMode()
+	if err != nil {
+		return fmt.Errorf("error determining cgroup mode: %v", err)
+	}
+	if mode == Unified {
+		return CreateCgroupsV2(root, subcgroup, serviceNames)
+	}
+
 	cgroupsFile, err := os.Open("/proc/cgroups")
 	if err != nil {
 		return err
@@ -313,6 +484,13 @@ func CreateCgroups(root string, subcgroup string, serviceNames []string) error {
 					return fmt.Errorf("error bind mounting %q: %v", cgroupFilePath, err)
 				}
 			}
+
+			if c == "devices" {
+				emu := &DeviceRuleEmulator{}
+				if err := emu.Transition(appCgroup, DefaultDeviceRules); err != nil {
+					return fmt.Errorf("error programming default device rules for %q: %v", appCgroup, err)
+				}
+			}
 		}
 
 		// 3d. Re-mount controller read-only to prevent the container modifying host controllers
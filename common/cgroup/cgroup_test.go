@@ -0,0 +1,111 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package cgroup
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/go-systemd/unit"
+	"github.com/coreos/rkt/Godeps/_workspace/src/k8s.io/kubernetes/pkg/api/resource"
+)
+
+func findOption(opts []*unit.UnitOption, name string) (string, bool) {
+	for _, o := range opts {
+		if o.Name == name {
+			return o.Value, true
+		}
+	}
+	return "", false
+}
+
+func TestAddPidsLimit(t *testing.T) {
+	limit := resource.MustParse("32")
+	opts, err := addPidsLimit(nil, &limit)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	v, ok := findOption(opts, "TasksMax")
+	if !ok || v != "32" {
+		t.Errorf("expected TasksMax=32, got %q (found=%v)", v, ok)
+	}
+}
+
+func TestAddBlockIOIsolator(t *testing.T) {
+	devices := []BlockIODevice{
+		{Major: 8, Minor: 0, ReadBPS: 1024, WriteBPS: 2048},
+	}
+	opts, err := AddBlockIOIsolator(nil, 500, devices)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if v, ok := findOption(opts, "BlockIOWeight"); !ok || v != "500" {
+		t.Errorf("expected BlockIOWeight=500, got %q (found=%v)", v, ok)
+	}
+	if v, ok := findOption(opts, "BlockIOReadBandwidth"); !ok || v != "8:0 1024" {
+		t.Errorf("expected BlockIOReadBandwidth=\"8:0 1024\", got %q (found=%v)", v, ok)
+	}
+	if v, ok := findOption(opts, "BlockIOWriteBandwidth"); !ok || v != "8:0 2048" {
+		t.Errorf("expected BlockIOWriteBandwidth=\"8:0 2048\", got %q (found=%v)", v, ok)
+	}
+}
+
+func TestAddBlockIOIsolatorPerDeviceWeightAndIOPS(t *testing.T) {
+	devices := []BlockIODevice{
+		{Major: 8, Minor: 16, Weight: 200, ReadIOPS: 500, WriteIOPS: 250},
+	}
+	opts, err := AddBlockIOIsolator(nil, 0, devices)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if v, ok := findOption(opts, "BlockIODeviceWeight"); !ok || v != "8:16 200" {
+		t.Errorf("expected BlockIODeviceWeight=\"8:16 200\", got %q (found=%v)", v, ok)
+	}
+	if v, ok := findOption(opts, "IOReadIOPSMax"); !ok || v != "8:16 500" {
+		t.Errorf("expected IOReadIOPSMax=\"8:16 500\", got %q (found=%v)", v, ok)
+	}
+	if v, ok := findOption(opts, "IOWriteIOPSMax"); !ok || v != "8:16 250" {
+		t.Errorf("expected IOWriteIOPSMax=\"8:16 250\", got %q (found=%v)", v, ok)
+	}
+}
+
+func TestWriteHugetlbLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-cgroup-hugetlb-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	knob := filepath.Join(dir, "hugetlb.2MB.limit_in_bytes")
+	if err := ioutil.WriteFile(knob, []byte("0"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	limit := resource.MustParse("64Mi")
+	if err := WriteHugetlbLimit(dir, "2MB", &limit); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := ioutil.ReadFile(knob)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != "67108864" {
+		t.Errorf("expected 67108864 bytes, got %q", string(got))
+	}
+}
@@ -0,0 +1,286 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package cgroup
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/k8s.io/kubernetes/pkg/api/resource"
+)
+
+// Mode identifies which cgroup hierarchy layout the host is using.
+type Mode int
+
+const (
+	// Unknown means the mode couldn't be determined.
+	Unknown Mode = iota
+	// Legacy is the cgroup v1 multi-hierarchy layout, one mount per
+	// controller under /sys/fs/cgroup/<controller>.
+	Legacy
+	// Unified is the cgroup v2 single-hierarchy layout: a single
+	// "cgroup2" mount at /sys/fs/cgroup exposing every controller.
+	Unified
+	// Hybrid is systemd's default since v234: a "cgroup2" mount used only
+	// for the systemd-managed hierarchy, alongside legacy v1 controller
+	// mounts for actual resource control.
+	Hybrid
+)
+
+// unifiedMountPoint is where a pure cgroup v2 host mounts its single
+// "cgroup2" hierarchy.
+const unifiedMountPoint = "/sys/fs/cgroup"
+
+// GetMode inspects /proc/self/mountinfo to determine whether the host is
+// running cgroup v1 (Legacy), cgroup v2 (Unified), or both at once (Hybrid).
+func GetMode() (Mode, error) {
+	mountinfo, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return Unknown, err
+	}
+	defer mountinfo.Close()
+
+	return parseMountinfoMode(mountinfo)
+}
+
+func parseMountinfoMode(f io.Reader) (Mode, error) {
+	var hasUnifiedRoot, hasUnifiedSub, hasLegacy bool
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+
+		// The mount options fields are followed by a literal "-"
+		// separator, then the filesystem type; its position varies with
+		// the number of optional fields, so find it rather than assume
+		// a fixed index.
+		sepIdx := -1
+		for i, f := range fields {
+			if f == "-" {
+				sepIdx = i
+				break
+			}
+		}
+		if sepIdx == -1 || sepIdx+1 >= len(fields) || len(fields) < 5 {
+			continue
+		}
+
+		mountPoint := fields[4]
+		switch fields[sepIdx+1] {
+		case "cgroup2":
+			if mountPoint == unifiedMountPoint {
+				hasUnifiedRoot = true
+			} else if strings.HasPrefix(mountPoint, unifiedMountPoint+"/") {
+				hasUnifiedSub = true
+			}
+		case "cgroup":
+			hasLegacy = true
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return Unknown, err
+	}
+
+	switch {
+	case hasUnifiedRoot:
+		// A single cgroup2 mount at /sys/fs/cgroup itself is the pure
+		// unified layout; legacy per-controller mounts can't coexist
+		// with it since they'd need to live under the same root.
+		return Unified, nil
+	case hasLegacy && hasUnifiedSub:
+		// systemd's default since v234: a cgroup2 mount dedicated to the
+		// systemd hierarchy (typically /sys/fs/cgroup/unified) alongside
+		// legacy per-controller mounts used for actual resource control.
+		return Hybrid, nil
+	case hasLegacy:
+		return Legacy, nil
+	default:
+		return Unknown, nil
+	}
+}
+
+// unifiedControllers returns the controllers the unified hierarchy's root
+// cgroup.controllers advertises as available.
+func unifiedControllers() ([]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(unifiedMountPoint, "cgroup.controllers"))
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// enableSubtreeControllers writes "+<controller>" for each of controllers
+// into cgroupPath's cgroup.subtree_control, delegating them to the cgroup's
+// children. This must be done at each level of the hierarchy a controller
+// needs to be usable in, per the unified hierarchy's top-down delegation
+// model.
+func enableSubtreeControllers(cgroupPath string, controllers []string) error {
+	if len(controllers) == 0 {
+		return nil
+	}
+	enable := make([]string, len(controllers))
+	for i, c := range controllers {
+		enable[i] = "+" + c
+	}
+	subtreeControl := filepath.Join(cgroupPath, "cgroup.subtree_control")
+	return ioutil.WriteFile(subtreeControl, []byte(strings.Join(enable, " ")), 0644)
+}
+
+// cgroupV2LeafFiles are the per-app knobs that stay read-write on a unified
+// hierarchy so the systemd inside stage1 can apply isolators to them;
+// cgroup.procs always needs to be read-write for systemd to add processes to
+// the cgroup.
+var cgroupV2LeafFiles = []string{"cpu.max", "memory.max", "io.max", "pids.max", "cgroup.freeze", "cgroup.procs"}
+
+// CreateCgroupsV2 mounts a single unified cgroup2 hierarchy for the
+// container. It mirrors CreateCgroups' v1 behavior: the controllers needed
+// are delegated down to the pod's subcgroup, then the whole hierarchy is
+// mounted read-only except for the cgroupV2LeafFiles knobs in each app's own
+// leaf directory.
+func CreateCgroupsV2(root string, subcgroup string, serviceNames []string) error {
+	cgroupPath := filepath.Join(root, "/sys/fs/cgroup")
+	if err := os.MkdirAll(cgroupPath, 0700); err != nil {
+		return err
+	}
+
+	flags := uintptr(syscall.MS_NOSUID | syscall.MS_NOEXEC | syscall.MS_NODEV)
+	// nsdelegate was added in Linux 4.13 and lets the container's mount
+	// namespace be trusted to manage its own delegated subtree; fall back
+	// without it on older kernels.
+	if err := syscall.Mount("cgroup2", cgroupPath, "cgroup2", flags, "nsdelegate"); err != nil {
+		if err := syscall.Mount("cgroup2", cgroupPath, "cgroup2", flags, ""); err != nil {
+			return fmt.Errorf("error mounting %q: %v", cgroupPath, err)
+		}
+	}
+
+	controllers, err := unifiedControllers()
+	if err != nil {
+		return fmt.Errorf("error reading available controllers: %v", err)
+	}
+	if err := enableSubtreeControllers(cgroupPath, controllers); err != nil {
+		return fmt.Errorf("error enabling controllers on %q: %v", cgroupPath, err)
+	}
+
+	subcgroupPath := filepath.Join(cgroupPath, subcgroup)
+	if err := os.MkdirAll(subcgroupPath, 0755); err != nil {
+		return err
+	}
+	if err := enableSubtreeControllers(subcgroupPath, controllers); err != nil {
+		return fmt.Errorf("error enabling controllers on %q: %v", subcgroupPath, err)
+	}
+
+	for _, serviceName := range serviceNames {
+		appCgroup := filepath.Join(subcgroupPath, serviceName)
+		if err := os.MkdirAll(appCgroup, 0755); err != nil {
+			return err
+		}
+		for _, f := range cgroupV2LeafFiles {
+			cgroupFilePath := filepath.Join(appCgroup, f)
+			// the file may not be there if the kernel doesn't support
+			// the feature, skip it in that case
+			if _, err := os.Stat(cgroupFilePath); os.IsNotExist(err) {
+				continue
+			}
+			if err := syscall.Mount(cgroupFilePath, cgroupFilePath, "", syscall.MS_BIND, ""); err != nil {
+				return fmt.Errorf("error bind mounting %q: %v", cgroupFilePath, err)
+			}
+		}
+	}
+
+	flags = syscall.MS_BIND |
+		syscall.MS_REMOUNT |
+		syscall.MS_NOSUID |
+		syscall.MS_NOEXEC |
+		syscall.MS_NODEV |
+		syscall.MS_RDONLY
+	if err := syscall.Mount(cgroupPath, cgroupPath, "", flags, ""); err != nil {
+		return fmt.Errorf("error remounting RO %q: %v", cgroupPath, err)
+	}
+
+	return nil
+}
+
+// cgroupV2DefaultCPUPeriod is the accounting period, in microseconds, rkt
+// assumes when translating a CPU isolator's fractional-CPU value into
+// cpu.max's "<quota> <period>" pair. It matches systemd's own default
+// CPUQuotaPeriodUSec=.
+const cgroupV2DefaultCPUPeriod = 100000
+
+// cpuMaxFromQuantity translates a CPU isolator's quantity (fractional CPUs,
+// e.g. "1500m" for 1.5 cores) into the "<quota> <period>" format cpu.max
+// expects.
+func cpuMaxFromQuantity(limit *resource.Quantity) (string, error) {
+	if limit.Value() > resource.MaxMilliValue {
+		return "", fmt.Errorf("cpu limit exceeds the maximum millivalue: %v", limit.String())
+	}
+	quota := limit.MilliValue() * cgroupV2DefaultCPUPeriod / 1000
+	return fmt.Sprintf("%d %d", quota, cgroupV2DefaultCPUPeriod), nil
+}
+
+// memoryMaxFromQuantity translates a memory isolator's quantity into the
+// byte value memory.max expects.
+func memoryMaxFromQuantity(limit *resource.Quantity) string {
+	return strconv.FormatInt(limit.Value(), 10)
+}
+
+// cgroupV2ControllerFiles maps an isolator name to the unified hierarchy
+// knob it's written to.
+var cgroupV2ControllerFiles = map[string]string{
+	"cpu":    "cpu.max",
+	"memory": "memory.max",
+	"pids":   "pids.max",
+}
+
+// cgroupV2Translators maps an isolator name to the function that converts
+// its quantity into the unified hierarchy's own value format.
+var cgroupV2Translators = map[string]func(*resource.Quantity) (string, error){
+	"cpu": cpuMaxFromQuantity,
+	"memory": func(limit *resource.Quantity) (string, error) {
+		return memoryMaxFromQuantity(limit), nil
+	},
+	"pids": func(limit *resource.Quantity) (string, error) {
+		return strconv.FormatInt(limit.Value(), 10), nil
+	},
+}
+
+// WriteCgroupV2Limit translates an isolator's quantity using the unified
+// hierarchy's own format and writes it to the matching knob under
+// cgroupPath, e.g. WriteCgroupV2Limit(appCgroup, "cpu", limit) writes
+// "<quota> <period>" to appCgroup/cpu.max.
+func WriteCgroupV2Limit(cgroupPath, isolator string, limit *resource.Quantity) error {
+	translate, ok := cgroupV2Translators[isolator]
+	if !ok {
+		return fmt.Errorf("no cgroup v2 translator for isolator %q", isolator)
+	}
+	file, ok := cgroupV2ControllerFiles[isolator]
+	if !ok {
+		return fmt.Errorf("no cgroup v2 controller file for isolator %q", isolator)
+	}
+
+	value, err := translate(limit)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(cgroupPath, file), []byte(value), 0644)
+}
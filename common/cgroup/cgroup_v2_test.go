@@ -0,0 +1,152 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package cgroup
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/k8s.io/kubernetes/pkg/api/resource"
+)
+
+func TestParseMountinfoModeUnified(t *testing.T) {
+	mountinfo := `25 30 0:22 / /sys/fs/cgroup rw,nosuid,nodev,noexec shared:7 - cgroup2 cgroup2 rw,nsdelegate
+`
+	mode, err := parseMountinfoMode(strings.NewReader(mountinfo))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mode != Unified {
+		t.Errorf("expected Unified, got %v", mode)
+	}
+}
+
+func TestParseMountinfoModeHybrid(t *testing.T) {
+	mountinfo := `25 30 0:22 / /sys/fs/cgroup/unified rw,nosuid,nodev,noexec shared:7 - cgroup2 cgroup2 rw,nsdelegate
+26 30 0:23 / /sys/fs/cgroup/cpu rw,nosuid,nodev,noexec shared:8 - cgroup cgroup rw,cpu
+`
+	mode, err := parseMountinfoMode(strings.NewReader(mountinfo))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mode != Hybrid {
+		t.Errorf("expected Hybrid, got %v", mode)
+	}
+}
+
+func TestParseMountinfoModeLegacy(t *testing.T) {
+	mountinfo := `26 30 0:23 / /sys/fs/cgroup/cpu rw,nosuid,nodev,noexec shared:8 - cgroup cgroup rw,cpu
+`
+	mode, err := parseMountinfoMode(strings.NewReader(mountinfo))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mode != Legacy {
+		t.Errorf("expected Legacy, got %v", mode)
+	}
+}
+
+func TestParseOwnCgroupFileV2Line(t *testing.T) {
+	cgroupFile := "0::/machine.slice/app.service\n"
+	parts, err := parseOwnCgroupFile(strings.NewReader(cgroupFile), "cpu")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parts[2] != "/machine.slice/app.service" {
+		t.Errorf("expected path /machine.slice/app.service, got %q", parts[2])
+	}
+}
+
+func TestParseOwnCgroupFileV1Line(t *testing.T) {
+	cgroupFile := "4:cpu,cpuacct:/machine.slice/app.service\n"
+	parts, err := parseOwnCgroupFile(strings.NewReader(cgroupFile), "cpu")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parts[2] != "/machine.slice/app.service" {
+		t.Errorf("expected path /machine.slice/app.service, got %q", parts[2])
+	}
+}
+
+func TestCpuMaxFromQuantity(t *testing.T) {
+	limit := resource.MustParse("1500m")
+	v, err := cpuMaxFromQuantity(&limit)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v != "150000 100000" {
+		t.Errorf("expected quota/period \"150000 100000\", got %q", v)
+	}
+}
+
+func TestMemoryMaxFromQuantity(t *testing.T) {
+	limit := resource.MustParse("128Mi")
+	v := memoryMaxFromQuantity(&limit)
+	if v != "134217728" {
+		t.Errorf("expected 134217728 bytes, got %q", v)
+	}
+}
+
+func TestWriteCgroupV2Limit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-cgroup-v2-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cpuMax := filepath.Join(dir, "cpu.max")
+	if err := ioutil.WriteFile(cpuMax, []byte("max 100000"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	limit := resource.MustParse("500m")
+	if err := WriteCgroupV2Limit(dir, "cpu", &limit); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := ioutil.ReadFile(cpuMax)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != "50000 100000" {
+		t.Errorf("expected \"50000 100000\", got %q", string(got))
+	}
+}
+
+func TestWriteCgroupV2LimitPids(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-cgroup-v2-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pidsMax := filepath.Join(dir, "pids.max")
+	if err := ioutil.WriteFile(pidsMax, []byte("max"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	limit := resource.MustParse("64")
+	if err := WriteCgroupV2Limit(dir, "pids", &limit); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := ioutil.ReadFile(pidsMax)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != "64" {
+		t.Errorf("expected \"64\", got %q", string(got))
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package cgroup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// wildcard stands for the devices cgroup's "*", matching any major or minor
+// number.
+const wildcard = -1
+
+// DeviceRule is a single devices.allow/devices.deny line: "<type> <major>:
+// <minor> <access>", e.g. {Type: 'c', Major: 1, Minor: 3, Access: "rwm"} is
+// "c 1:3 rwm". Major or Minor of wildcard prints as "*".
+type DeviceRule struct {
+	Type   byte // 'a' (all), 'c' (char), or 'b' (block)
+	Major  int64
+	Minor  int64
+	Access string // any combination of 'r', 'w', 'm'
+}
+
+// denyAll is the rule that clears every previously allowed device; it's
+// emitted first on an emulator's first transition and on any transition
+// that drops a current rule, since the devices cgroup's allow/deny files are
+// append-only and there's no way to remove a single prior rule.
+var denyAll = DeviceRule{Type: 'a', Major: wildcard, Minor: wildcard, Access: "rwm"}
+
+// DefaultDeviceRules is rkt's default device whitelist, granting apps the
+// same minimal set of pseudo-devices Docker/runc allow by default.
+var DefaultDeviceRules = []DeviceRule{
+	{Type: 'c', Major: 1, Minor: 3, Access: "rwm"},          // /dev/null
+	{Type: 'c', Major: 1, Minor: 5, Access: "rwm"},          // /dev/zero
+	{Type: 'c', Major: 1, Minor: 7, Access: "rwm"},          // /dev/full
+	{Type: 'c', Major: 1, Minor: 8, Access: "rwm"},          // /dev/random
+	{Type: 'c', Major: 1, Minor: 9, Access: "rwm"},          // /dev/urandom
+	{Type: 'c', Major: 5, Minor: 0, Access: "rwm"},          // /dev/tty
+	{Type: 'c', Major: 5, Minor: 1, Access: "rwm"},          // /dev/console
+	{Type: 'c', Major: 5, Minor: 2, Access: "rwm"},          // /dev/ptmx
+	{Type: 'c', Major: 136, Minor: wildcard, Access: "rwm"}, // /dev/pts/*
+}
+
+func (r DeviceRule) String() string {
+	major := "*"
+	if r.Major != wildcard {
+		major = fmt.Sprintf("%d", r.Major)
+	}
+	minor := "*"
+	if r.Minor != wildcard {
+		minor = fmt.Sprintf("%d", r.Minor)
+	}
+	return fmt.Sprintf("%c %s:%s %s", r.Type, major, minor, r.Access)
+}
+
+// DeviceRuleEmulator tracks the devices cgroup's actual rule set in memory,
+// since the kernel only exposes it as a pair of append-only allow/deny
+// files: there's no way to read back "what's currently allowed", and no way
+// to remove a single rule without resetting everything with "a *:* rwm" on
+// devices.deny first.
+type DeviceRuleEmulator struct {
+	current []DeviceRule
+	// reset tracks whether this emulator has ever written the deny-all
+	// reset. A freshly created emulator's current == nil must not be
+	// mistaken for "the cgroup has no rules": the kernel's actual devices
+	// cgroup starts out fully permissive, not empty, so the very first
+	// Transition call always needs the reset regardless of how target
+	// compares to the zero-value current.
+	reset bool
+}
+
+// Transition computes the minimal devices.deny/devices.allow writes needed
+// to move from the emulator's current rule set to target, applies them to
+// cgroupPath, and updates the emulator's record of the current set.
+//
+// Because a deny can't selectively retract one earlier allow, any
+// transition whose target isn't a superset of the current rules is
+// implemented as a full reset ("a *:* rwm" on deny) followed by allowing
+// every rule in target. The first transition on a given cgroup always
+// resets, since the cgroup's real starting state is allow-all, not empty.
+func (e *DeviceRuleEmulator) Transition(cgroupPath string, target []DeviceRule) error {
+	if !e.reset || !isSuperset(target, e.current) {
+		if err := writeDeviceRule(cgroupPath, "devices.deny", denyAll); err != nil {
+			return err
+		}
+		e.current = nil
+		e.reset = true
+	}
+
+	for _, rule := range target {
+		if contains(e.current, rule) {
+			continue
+		}
+		if err := writeDeviceRule(cgroupPath, "devices.allow", rule); err != nil {
+			return err
+		}
+		e.current = append(e.current, rule)
+	}
+
+	return nil
+}
+
+func isSuperset(target, current []DeviceRule) bool {
+	for _, c := range current {
+		if !contains(target, c) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(rules []DeviceRule, rule DeviceRule) bool {
+	for _, r := range rules {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func writeDeviceRule(cgroupPath, file string, rule DeviceRule) error {
+	path := filepath.Join(cgroupPath, file)
+	if err := ioutil.WriteFile(path, []byte(rule.String()), 0200); err != nil {
+		return fmt.Errorf("error writing %q to %q: %v", rule, path, err)
+	}
+	return nil
+}
+
+// The cgroup v2 unified hierarchy has no devices controller at all; the
+// kernel instead expects a BPF_CGROUP_DEVICE program attached to the
+// cgroup, enforcing the same allow/deny decisions from inside the kernel.
+// Compiling and loading that eBPF program needs a BPF syscall wrapper this
+// tree doesn't vendor, so there is no v2 code path here yet; stage1 should
+// fall back to relying on the pod's mount/user namespacing for device
+// isolation on unified-only hosts until one is added.
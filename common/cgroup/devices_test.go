@@ -0,0 +1,102 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package cgroup
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeviceRuleString(t *testing.T) {
+	r := DeviceRule{Type: 'c', Major: 1, Minor: 3, Access: "rwm"}
+	if r.String() != "c 1:3 rwm" {
+		t.Errorf("expected \"c 1:3 rwm\", got %q", r.String())
+	}
+
+	wild := DeviceRule{Type: 'c', Major: 136, Minor: wildcard, Access: "rwm"}
+	if wild.String() != "c 136:* rwm" {
+		t.Errorf("expected \"c 136:* rwm\", got %q", wild.String())
+	}
+}
+
+func TestDeviceRuleEmulatorTransitionFromEmpty(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-cgroup-devices-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	allow := filepath.Join(dir, "devices.allow")
+	deny := filepath.Join(dir, "devices.deny")
+	if err := ioutil.WriteFile(allow, nil, 0200); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ioutil.WriteFile(deny, nil, 0200); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	emu := &DeviceRuleEmulator{}
+	target := []DeviceRule{
+		{Type: 'c', Major: 1, Minor: 3, Access: "rwm"},
+		{Type: 'c', Major: 1, Minor: 5, Access: "rwm"},
+	}
+	if err := emu.Transition(dir, target); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(emu.current) != len(target) {
+		t.Fatalf("expected emulator to record %d rules, got %d", len(target), len(emu.current))
+	}
+
+	denyWritten, err := ioutil.ReadFile(deny)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(denyWritten) != denyAll.String() {
+		t.Errorf("expected the first transition to write the deny-all reset %q, got %q", denyAll.String(), denyWritten)
+	}
+}
+
+func TestDeviceRuleEmulatorGrowingTransitionSkipsDeny(t *testing.T) {
+	emu := &DeviceRuleEmulator{
+		current: []DeviceRule{{Type: 'c', Major: 1, Minor: 3, Access: "rwm"}},
+		reset:   true,
+	}
+
+	// A target that's a strict superset of the current rules shouldn't
+	// need a reset, since nothing needs to be retracted.
+	target := []DeviceRule{
+		{Type: 'c', Major: 1, Minor: 3, Access: "rwm"},
+		{Type: 'c', Major: 1, Minor: 5, Access: "rwm"},
+	}
+	if !isSuperset(target, emu.current) {
+		t.Error("expected target to be recognized as a superset of the current rules")
+	}
+}
+
+func TestDeviceRuleEmulatorShrinkingTransitionNeedsDeny(t *testing.T) {
+	emu := &DeviceRuleEmulator{
+		current: []DeviceRule{
+			{Type: 'c', Major: 1, Minor: 3, Access: "rwm"},
+			{Type: 'c', Major: 1, Minor: 5, Access: "rwm"},
+		},
+	}
+
+	target := []DeviceRule{{Type: 'c', Major: 1, Minor: 3, Access: "rwm"}}
+	if isSuperset(target, emu.current) {
+		t.Error("expected a shrinking target to require a deny-all reset")
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package cgroup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FreezerState is the state rkt reports back for a pod or app cgroup,
+// normalized across the v1 freezer.state and v2 cgroup.freeze knobs.
+type FreezerState string
+
+const (
+	StateThawed   FreezerState = "THAWED"
+	StateFreezing FreezerState = "FREEZING"
+	StateFrozen   FreezerState = "FROZEN"
+)
+
+// freezerPollInterval and freezerPollAttempts bound how long Freeze waits
+// for the kernel to settle out of the transitional FREEZING state, since
+// writing "FROZEN" to freezer.state only requests a freeze; the write
+// itself returns before every task in the cgroup has actually stopped.
+const (
+	freezerPollInterval = 10 * time.Millisecond
+	freezerPollAttempts = 500
+)
+
+// Freeze suspends every task in the cgroup at cgroupPath, blocking until the
+// kernel reports the transition out of FREEZING is complete.
+//
+// Wiring this up to "rkt app pause"/"rkt app resume" subcommands belongs in
+// cmd/rkt, which isn't part of this tree.
+func Freeze(cgroupPath string) error {
+	return setFreezerState(cgroupPath, StateFrozen)
+}
+
+// Thaw resumes every task in the cgroup at cgroupPath previously suspended
+// by Freeze.
+func Thaw(cgroupPath string) error {
+	return setFreezerState(cgroupPath, StateThawed)
+}
+
+func setFreezerState(cgroupPath string, target FreezerState) error {
+	mode, err := GetMode()
+	if err != nil {
+		return fmt.Errorf("error determining cgroup mode: %v", err)
+	}
+
+	path, value := freezerFileAndValue(mode, target)
+	if err := ioutil.WriteFile(filepath.Join(cgroupPath, path), []byte(value), 0644); err != nil {
+		return fmt.Errorf("error writing %q: %v", path, err)
+	}
+
+	for i := 0; i < freezerPollAttempts; i++ {
+		state, err := GetFreezerState(cgroupPath)
+		if err != nil {
+			return err
+		}
+		if state == target {
+			return nil
+		}
+		// FREEZING is transitional: the kernel is still walking the
+		// cgroup's tasks, so keep polling rather than treating it as
+		// a failure.
+		time.Sleep(freezerPollInterval)
+	}
+
+	return fmt.Errorf("timed out waiting for %q to reach state %q", cgroupPath, target)
+}
+
+// freezerFileAndValue returns the knob to write and the value that
+// requests target, which differs between v1's freezer.state
+// ("FROZEN"/"THAWED") and v2's cgroup.freeze ("1"/"0").
+func freezerFileAndValue(mode Mode, target FreezerState) (string, string) {
+	if mode == Unified {
+		if target == StateFrozen {
+			return "cgroup.freeze", "1"
+		}
+		return "cgroup.freeze", "0"
+	}
+	return "freezer.state", string(target)
+}
+
+// GetFreezerState reports the current freezer state of the cgroup at
+// cgroupPath.
+func GetFreezerState(cgroupPath string) (FreezerState, error) {
+	mode, err := GetMode()
+	if err != nil {
+		return "", fmt.Errorf("error determining cgroup mode: %v", err)
+	}
+
+	if mode == Unified {
+		// cgroup.freeze only reads back the requested state; the "frozen"
+		// key of cgroup.events reports whether the freeze has completed.
+		events, err := readKeyedFile(filepath.Join(cgroupPath, "cgroup.events"))
+		if err != nil {
+			return "", err
+		}
+		if events["frozen"] == 1 {
+			return StateFrozen, nil
+		}
+		data, err := ioutil.ReadFile(filepath.Join(cgroupPath, "cgroup.freeze"))
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(string(data)) == "1" {
+			return StateFreezing, nil
+		}
+		return StateThawed, nil
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(cgroupPath, "freezer.state"))
+	if err != nil {
+		return "", err
+	}
+	return FreezerState(strings.TrimSpace(string(data))), nil
+}
@@ -0,0 +1,43 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package cgroup
+
+import "testing"
+
+func TestFreezerFileAndValueV1(t *testing.T) {
+	file, value := freezerFileAndValue(Legacy, StateFrozen)
+	if file != "freezer.state" || value != "FROZEN" {
+		t.Errorf("expected freezer.state/FROZEN, got %s/%s", file, value)
+	}
+
+	file, value = freezerFileAndValue(Legacy, StateThawed)
+	if file != "freezer.state" || value != "THAWED" {
+		t.Errorf("expected freezer.state/THAWED, got %s/%s", file, value)
+	}
+}
+
+func TestFreezerFileAndValueV2(t *testing.T) {
+	file, value := freezerFileAndValue(Unified, StateFrozen)
+	if file != "cgroup.freeze" || value != "1" {
+		t.Errorf("expected cgroup.freeze/1, got %s/%s", file, value)
+	}
+
+	file, value = freezerFileAndValue(Unified, StateThawed)
+	if file != "cgroup.freeze" || value != "0" {
+		t.Errorf("expected cgroup.freeze/0, got %s/%s", file, value)
+	}
+}
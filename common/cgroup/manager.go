@@ -0,0 +1,205 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package cgroup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/k8s.io/kubernetes/pkg/api/resource"
+)
+
+// Resources is the set of per-pod/per-app limits a Manager can apply,
+// independent of whether the backend ends up writing cgroupfs knobs
+// directly or passing unit properties to systemd over D-Bus.
+type Resources struct {
+	CPUQuota           *resource.Quantity
+	Memory             *resource.Quantity
+	Tasks              *resource.Quantity
+	IOWeight           uint16
+	AllowedCPUs        string
+	AllowedMemoryNodes string
+}
+
+// Manager abstracts how a pod or app's resource limits get applied to the
+// kernel, so callers don't need to know whether the host is using rkt's own
+// direct cgroupfs mounting (cgroupfsManager) or delegating to systemd
+// (systemdManager, the only supported backend under cgroup v2 unified mode
+// on systemd hosts).
+type Manager interface {
+	// Apply moves pid into the cgroup this Manager manages, creating it
+	// first if necessary.
+	Apply(pid int) error
+	// Set applies resources to the cgroup.
+	Set(resources *Resources) error
+	// Destroy removes the cgroup.
+	Destroy() error
+	// Path returns the cgroupfs path of the given controller, for
+	// callers (like stats collection) that still need to read files
+	// directly out of the hierarchy.
+	Path(subsystem string) string
+	// Stats returns the current runtime accounting for the cgroup.
+	Stats() (*Stats, error)
+}
+
+// cgroupfsManager implements Manager on top of CreateCgroups' layout: one
+// cgroup per controller, at root/sys/fs/cgroup/<controller>/<name>, where
+// name is the cgroup's path below the controller's root.
+type cgroupfsManager struct {
+	root string
+	name string
+}
+
+// NewCgroupfsManager returns a Manager that reads and writes the cgroupfs
+// hierarchy CreateCgroups already mounted at root for the app or pod
+// identified by name (its systemd service/subcgroup name).
+func NewCgroupfsManager(root, name string) Manager {
+	return &cgroupfsManager{root: root, name: name}
+}
+
+func (m *cgroupfsManager) Path(subsystem string) string {
+	return filepath.Join(m.root, "sys/fs/cgroup", subsystem, m.name)
+}
+
+func (m *cgroupfsManager) Apply(pid int) error {
+	mode, err := GetMode()
+	if err != nil {
+		return fmt.Errorf("error determining cgroup mode: %v", err)
+	}
+
+	var controllers []string
+	if mode == Unified {
+		controllers = []string{""}
+	} else {
+		cgroupsFile, err := os.Open("/proc/cgroups")
+		if err != nil {
+			return err
+		}
+		defer cgroupsFile.Close()
+		cgroups, err := parseCgroups(cgroupsFile)
+		if err != nil {
+			return fmt.Errorf("error parsing /proc/cgroups: %v", err)
+		}
+		controllers = getControllers(cgroups)
+	}
+
+	for _, c := range controllers {
+		path := m.Path(c)
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(path, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+			return fmt.Errorf("error adding pid %d to %q: %v", pid, path, err)
+		}
+	}
+	return nil
+}
+
+// Set writes the CPUQuota, Memory and Tasks limits to their cgroupfs knobs.
+// IOWeight, AllowedCPUs and AllowedMemoryNodes are not applied by this
+// backend.
+func (m *cgroupfsManager) Set(resources *Resources) error {
+	mode, err := GetMode()
+	if err != nil {
+		return fmt.Errorf("error determining cgroup mode: %v", err)
+	}
+
+	if mode == Unified {
+		path := m.Path("")
+		if resources.CPUQuota != nil {
+			if err := WriteCgroupV2Limit(path, "cpu", resources.CPUQuota); err != nil {
+				return err
+			}
+		}
+		if resources.Memory != nil {
+			if err := WriteCgroupV2Limit(path, "memory", resources.Memory); err != nil {
+				return err
+			}
+		}
+		if resources.Tasks != nil {
+			if err := WriteCgroupV2Limit(path, "pids", resources.Tasks); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if resources.CPUQuota != nil {
+		quota := resources.CPUQuota.MilliValue() * int64(cgroupV2DefaultCPUPeriod) / 1000
+		if err := ioutil.WriteFile(filepath.Join(m.Path("cpu"), "cpu.cfs_quota_us"), []byte(strconv.FormatInt(quota, 10)), 0644); err != nil {
+			return err
+		}
+	}
+	if resources.Memory != nil {
+		if err := ioutil.WriteFile(filepath.Join(m.Path("memory"), "memory.limit_in_bytes"), []byte(strconv.FormatInt(resources.Memory.Value(), 10)), 0644); err != nil {
+			return err
+		}
+	}
+	if resources.Tasks != nil {
+		if err := ioutil.WriteFile(filepath.Join(m.Path("pids"), "pids.max"), []byte(strconv.FormatInt(resources.Tasks.Value(), 10)), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *cgroupfsManager) Destroy() error {
+	mode, err := GetMode()
+	if err != nil {
+		return fmt.Errorf("error determining cgroup mode: %v", err)
+	}
+
+	if mode == Unified {
+		return os.RemoveAll(m.Path(""))
+	}
+
+	cgroupsFile, err := os.Open("/proc/cgroups")
+	if err != nil {
+		return err
+	}
+	defer cgroupsFile.Close()
+	cgroups, err := parseCgroups(cgroupsFile)
+	if err != nil {
+		return fmt.Errorf("error parsing /proc/cgroups: %v", err)
+	}
+	for _, c := range getControllers(cgroups) {
+		if err := os.RemoveAll(m.Path(c)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *cgroupfsManager) Stats() (*Stats, error) {
+	return GetStats(m.Path)
+}
+
+// IsSystemdHost reports whether pid 1 is systemd, which callers use to pick
+// a default backend: NewSystemdManager is the only supported choice under
+// cgroup v2 unified mode, since systemd owns the root of that hierarchy and
+// refuses to delegate subtrees it didn't create itself.
+func IsSystemdHost() bool {
+	comm, err := ioutil.ReadFile("/proc/1/comm")
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(string(comm)) == "systemd"
+}
@@ -0,0 +1,133 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package cgroup
+
+import (
+	"fmt"
+
+	systemdDbus "github.com/coreos/rkt/Godeps/_workspace/src/github.com/coreos/go-systemd/dbus"
+	godbus "github.com/coreos/rkt/Godeps/_workspace/src/github.com/godbus/dbus"
+)
+
+// systemdManager implements Manager by asking systemd, over its private
+// D-Bus socket, to create and own a transient scope unit for the pod or app
+// rather than writing cgroupfs knobs directly. This is the only supported
+// backend on a cgroup v2 unified host, since systemd refuses to delegate a
+// subtree of the hierarchy it doesn't itself manage.
+type systemdManager struct {
+	conn *systemdDbus.Conn
+	unit string
+}
+
+// NewSystemdManager connects to systemd's private D-Bus socket and returns a
+// Manager that will create the transient scope unitName on first Apply.
+// unitName must end in ".scope" or ".slice", per systemd's naming rules for
+// transient units.
+//
+// Choosing between NewSystemdManager and NewCgroupfsManager is a stage1
+// concern that belongs behind a "--cgroup-manager=cgroupfs|systemd" flag,
+// defaulting via IsSystemdHost autodetection; that flag plumbing lives in
+// cmd/rkt, which isn't part of this tree.
+func NewSystemdManager(unitName string) (Manager, error) {
+	conn, err := systemdDbus.New()
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to systemd: %v", err)
+	}
+	return &systemdManager{conn: conn, unit: unitName}, nil
+}
+
+func (m *systemdManager) Apply(pid int) error {
+	properties := []systemdDbus.Property{
+		{Name: "PIDs", Value: godbus.MakeVariant([]uint32{uint32(pid)})},
+		{Name: "Delegate", Value: godbus.MakeVariant(true)},
+		{Name: "MemoryAccounting", Value: godbus.MakeVariant(true)},
+		{Name: "CPUAccounting", Value: godbus.MakeVariant(true)},
+		{Name: "TasksAccounting", Value: godbus.MakeVariant(true)},
+	}
+
+	ch := make(chan string, 1)
+	if _, err := m.conn.StartTransientUnit(m.unit, "replace", properties, ch); err != nil {
+		return fmt.Errorf("error creating transient unit %q: %v", m.unit, err)
+	}
+	if result := <-ch; result != "done" {
+		return fmt.Errorf("error creating transient unit %q: job result %q", m.unit, result)
+	}
+	return nil
+}
+
+// Set pushes resources down as unit properties rather than writing cgroupfs
+// files directly, so systemd stays the single writer of its own hierarchy.
+func (m *systemdManager) Set(resources *Resources) error {
+	var properties []systemdDbus.Property
+
+	if resources.CPUQuota != nil {
+		// CPUQuotaPerSecUSec wants microseconds of CPU time allowed per
+		// second of wall time; MilliValue is milli-cores, so scale by 1000.
+		usec := uint64(resources.CPUQuota.MilliValue()) * 1000
+		properties = append(properties, systemdDbus.Property{Name: "CPUQuotaPerSecUSec", Value: godbus.MakeVariant(usec)})
+	}
+	if resources.Memory != nil {
+		properties = append(properties, systemdDbus.Property{Name: "MemoryMax", Value: godbus.MakeVariant(uint64(resources.Memory.Value()))})
+	}
+	if resources.Tasks != nil {
+		properties = append(properties, systemdDbus.Property{Name: "TasksMax", Value: godbus.MakeVariant(uint64(resources.Tasks.Value()))})
+	}
+	if resources.IOWeight != 0 {
+		properties = append(properties, systemdDbus.Property{Name: "IOWeight", Value: godbus.MakeVariant(uint64(resources.IOWeight))})
+	}
+	if resources.AllowedCPUs != "" {
+		properties = append(properties, systemdDbus.Property{Name: "AllowedCPUs", Value: godbus.MakeVariant(resources.AllowedCPUs)})
+	}
+	if resources.AllowedMemoryNodes != "" {
+		properties = append(properties, systemdDbus.Property{Name: "AllowedMemoryNodes", Value: godbus.MakeVariant(resources.AllowedMemoryNodes)})
+	}
+
+	if len(properties) == 0 {
+		return nil
+	}
+	if err := m.conn.SetUnitProperties(m.unit, true, properties...); err != nil {
+		return fmt.Errorf("error setting properties on %q: %v", m.unit, err)
+	}
+	return nil
+}
+
+func (m *systemdManager) Destroy() error {
+	ch := make(chan string, 1)
+	if _, err := m.conn.StopUnit(m.unit, "replace", ch); err != nil {
+		return fmt.Errorf("error stopping transient unit %q: %v", m.unit, err)
+	}
+	if result := <-ch; result != "done" {
+		return fmt.Errorf("error stopping transient unit %q: job result %q", m.unit, result)
+	}
+	return nil
+}
+
+// Path approximates where systemd placed the unit's cgroup. systemd exposes
+// the real answer via the unit's ControlGroup property, but since every
+// transient scope this package creates is unparented, it always lands
+// directly under system.slice.
+func (m *systemdManager) Path(subsystem string) string {
+	mp, err := ControllerMountPoint(subsystem)
+	if err != nil {
+		mp = unifiedMountPoint
+	}
+	return mp + "/system.slice/" + m.unit
+}
+
+func (m *systemdManager) Stats() (*Stats, error) {
+	return GetStats(m.Path)
+}
@@ -0,0 +1,30 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package cgroup
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCgroupfsManagerPath(t *testing.T) {
+	m := NewCgroupfsManager("/var/lib/rkt/pods/run/abcd", "app.service")
+	expected := filepath.Join("/var/lib/rkt/pods/run/abcd", "sys/fs/cgroup", "memory", "app.service")
+	if got := m.Path("memory"); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package cgroup
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ControllerMountPoint finds where a given v1 controller (e.g. "cpu",
+// "memory", "blkio") is mounted, by parsing /proc/self/mountinfo, so callers
+// outside stage1 (which already knows its own layout from CreateCgroups) can
+// locate a pod or app's accounting files without duplicating that mount
+// logic. On a unified (cgroup v2) host, every controller lives under the
+// single cgroup2 mount, so controller is ignored and unifiedMountPoint is
+// returned.
+func ControllerMountPoint(controller string) (string, error) {
+	if mode, err := GetMode(); err == nil && mode == Unified {
+		return unifiedMountPoint, nil
+	}
+
+	mountinfo, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", err
+	}
+	defer mountinfo.Close()
+
+	return parseControllerMountPoint(mountinfo, controller)
+}
+
+func parseControllerMountPoint(f io.Reader, controller string) (string, error) {
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+
+		sepIdx := -1
+		for i, field := range fields {
+			if field == "-" {
+				sepIdx = i
+				break
+			}
+		}
+		// fields[sepIdx+1] is the filesystem type, fields[sepIdx+3] is the
+		// mount's super options (where a v1 cgroup mount lists which
+		// controller it was mounted with, e.g. "rw,cpu").
+		if sepIdx == -1 || sepIdx+3 >= len(fields) || len(fields) < 5 {
+			continue
+		}
+		if fields[sepIdx+1] != "cgroup" {
+			continue
+		}
+
+		for _, opt := range strings.Split(fields[sepIdx+3], ",") {
+			if opt == controller {
+				return fields[4], nil
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return "", err
+	}
+
+	return "", fmt.Errorf("no cgroup mount found for controller %q", controller)
+}
@@ -0,0 +1,43 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package cgroup
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseControllerMountPoint(t *testing.T) {
+	mountinfo := `29 28 0:26 / /sys/fs/cgroup/cpu rw,relatime shared:7 - cgroup cgroup rw,cpu
+32 28 0:29 / /sys/fs/cgroup/memory rw,relatime shared:9 - cgroup cgroup rw,memory
+`
+	mp, err := parseControllerMountPoint(strings.NewReader(mountinfo), "memory")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mp != "/sys/fs/cgroup/memory" {
+		t.Errorf("expected /sys/fs/cgroup/memory, got %q", mp)
+	}
+}
+
+func TestParseControllerMountPointNotFound(t *testing.T) {
+	mountinfo := `29 28 0:26 / /sys/fs/cgroup/cpu rw,relatime shared:7 - cgroup cgroup rw,cpu
+`
+	if _, err := parseControllerMountPoint(strings.NewReader(mountinfo), "memory"); err == nil {
+		t.Error("expected an error for a controller with no mount")
+	}
+}
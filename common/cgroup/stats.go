@@ -0,0 +1,276 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package cgroup
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CPUStats mirrors the accounting rkt can read back from either hierarchy.
+type CPUStats struct {
+	UsageNanos     uint64   `json:"usageNanos"`
+	UsagePerCPU    []uint64 `json:"usagePerCPU,omitempty"`
+	ThrottledNanos uint64   `json:"throttledNanos"`
+	NrThrottled    uint64   `json:"nrThrottled"`
+	NrPeriods      uint64   `json:"nrPeriods"`
+}
+
+// MemoryStats mirrors the accounting rkt can read back from either
+// hierarchy. SwapBytes and FailCount are only populated on v1, since v2's
+// memory.stat doesn't break swap out separately from the top-level
+// memory.swap.current, and memory.max has no analog to failcnt.
+type MemoryStats struct {
+	UsageBytes    uint64 `json:"usageBytes"`
+	MaxUsageBytes uint64 `json:"maxUsageBytes,omitempty"`
+	RSSBytes      uint64 `json:"rssBytes"`
+	CacheBytes    uint64 `json:"cacheBytes"`
+	SwapBytes     uint64 `json:"swapBytes,omitempty"`
+	FailCount     uint64 `json:"failCount,omitempty"`
+}
+
+// BlockIOStats mirrors the accounting rkt can read back from either
+// hierarchy's throttle/io counters.
+type BlockIOStats struct {
+	ReadBytes  uint64 `json:"readBytes"`
+	WriteBytes uint64 `json:"writeBytes"`
+	ReadIOs    uint64 `json:"readIOs"`
+	WriteIOs   uint64 `json:"writeIOs"`
+}
+
+// Stats is rkt's own JSON-stable view of a pod or app cgroup's runtime
+// accounting, deliberately kept identical whether it was gathered from a
+// cgroup v1 or v2 hierarchy so external monitors don't need to know which
+// one the host is running.
+type Stats struct {
+	CPU     CPUStats     `json:"cpu"`
+	Memory  MemoryStats  `json:"memory"`
+	PIDs    uint64       `json:"pids"`
+	BlockIO BlockIOStats `json:"blockIO"`
+}
+
+// GetStats reads runtime accounting for a cgroup, choosing the v1 or v2 file
+// set based on the host's current cgroup mode. path resolves a controller
+// name ("cpu", "memory", "pids", or "blkio") to the cgroup's directory in
+// that controller's hierarchy, where the accounting files are read from; on
+// v1, CreateCgroups mounts each controller under its own
+// directory, so path is called once per controller rather than assuming
+// they all share one. A Manager's Path method already has this signature
+// and is what callers should pass in. On a unified v2 host every controller
+// lives under the same mount, so path is only ever called with "".
+//
+// Wiring this up to a "rkt app status --stats"/"rkt status --stats" flag
+// belongs in cmd/rkt, which isn't part of this tree.
+func GetStats(path func(controller string) string) (*Stats, error) {
+	mode, err := GetMode()
+	if err != nil {
+		return nil, fmt.Errorf("error determining cgroup mode: %v", err)
+	}
+	if mode == Unified {
+		return getStatsV2(path(""))
+	}
+	return getStatsV1(path)
+}
+
+func getStatsV1(path func(controller string) string) (*Stats, error) {
+	s := &Stats{}
+
+	cpuPath := path("cpu")
+	if v, err := readUint64File(filepath.Join(cpuPath, "cpuacct.usage")); err == nil {
+		s.CPU.UsageNanos = v
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(cpuPath, "cpuacct.usage_percpu")); err == nil {
+		for _, f := range strings.Fields(string(data)) {
+			v, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				continue
+			}
+			s.CPU.UsagePerCPU = append(s.CPU.UsagePerCPU, v)
+		}
+	}
+	if stat, err := readKeyedFile(filepath.Join(cpuPath, "cpu.stat")); err == nil {
+		s.CPU.ThrottledNanos = stat["throttled_time"]
+		s.CPU.NrThrottled = stat["nr_throttled"]
+		s.CPU.NrPeriods = stat["nr_periods"]
+	}
+
+	memPath := path("memory")
+	if v, err := readUint64File(filepath.Join(memPath, "memory.usage_in_bytes")); err == nil {
+		s.Memory.UsageBytes = v
+	}
+	if v, err := readUint64File(filepath.Join(memPath, "memory.max_usage_in_bytes")); err == nil {
+		s.Memory.MaxUsageBytes = v
+	}
+	if v, err := readUint64File(filepath.Join(memPath, "memory.failcnt")); err == nil {
+		s.Memory.FailCount = v
+	}
+	if stat, err := readKeyedFile(filepath.Join(memPath, "memory.stat")); err == nil {
+		s.Memory.RSSBytes = stat["rss"]
+		s.Memory.CacheBytes = stat["cache"]
+		s.Memory.SwapBytes = stat["swap"]
+	}
+
+	if v, err := readUint64File(filepath.Join(path("pids"), "pids.current")); err == nil {
+		s.PIDs = v
+	}
+
+	if rb, wb, rios, wios, err := readBlkioThrottleFiles(path("blkio")); err == nil {
+		s.BlockIO.ReadBytes = rb
+		s.BlockIO.WriteBytes = wb
+		s.BlockIO.ReadIOs = rios
+		s.BlockIO.WriteIOs = wios
+	}
+
+	return s, nil
+}
+
+func getStatsV2(cgroupPath string) (*Stats, error) {
+	s := &Stats{}
+
+	if stat, err := readKeyedFile(filepath.Join(cgroupPath, "cpu.stat")); err == nil {
+		// cpu.stat reports usage_usec in microseconds; everything else in
+		// Stats is nanoseconds, so scale it up.
+		s.CPU.UsageNanos = stat["usage_usec"] * 1000
+		s.CPU.ThrottledNanos = stat["throttled_usec"] * 1000
+		s.CPU.NrThrottled = stat["nr_throttled"]
+		s.CPU.NrPeriods = stat["nr_periods"]
+	}
+
+	if v, err := readUint64File(filepath.Join(cgroupPath, "memory.current")); err == nil {
+		s.Memory.UsageBytes = v
+	}
+	if stat, err := readKeyedFile(filepath.Join(cgroupPath, "memory.stat")); err == nil {
+		s.Memory.RSSBytes = stat["anon"]
+		s.Memory.CacheBytes = stat["file"]
+	}
+
+	if v, err := readUint64File(filepath.Join(cgroupPath, "pids.current")); err == nil {
+		s.PIDs = v
+	}
+
+	if data, err := ioutil.ReadFile(filepath.Join(cgroupPath, "io.stat")); err == nil {
+		var rb, wb, rios, wios uint64
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			fields := strings.Fields(line)
+			for _, f := range fields[1:] {
+				kv := strings.SplitN(f, "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				v, err := strconv.ParseUint(kv[1], 10, 64)
+				if err != nil {
+					continue
+				}
+				switch kv[0] {
+				case "rbytes":
+					rb += v
+				case "wbytes":
+					wb += v
+				case "rios":
+					rios += v
+				case "wios":
+					wios += v
+				}
+			}
+		}
+		s.BlockIO.ReadBytes = rb
+		s.BlockIO.WriteBytes = wb
+		s.BlockIO.ReadIOs = rios
+		s.BlockIO.WriteIOs = wios
+	}
+
+	return s, nil
+}
+
+func readUint64File(path string) (uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// readKeyedFile parses the "<key> <value>" per-line format used by
+// cpu.stat, memory.stat, and their v2 equivalents.
+func readKeyedFile(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stat := make(map[string]uint64)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		stat[fields[0]] = v
+	}
+	return stat, sc.Err()
+}
+
+// readBlkioThrottleFiles sums blkio.throttle.io_service_bytes and
+// blkio.throttle.io_serviced across all devices, since rkt's Stats reports
+// pod/app-wide totals rather than a per-device breakdown.
+func readBlkioThrottleFiles(cgroupPath string) (readBytes, writeBytes, readIOs, writeIOs uint64, err error) {
+	bytes, err := readBlkioThrottleFile(filepath.Join(cgroupPath, "blkio.throttle.io_service_bytes"))
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	ios, err := readBlkioThrottleFile(filepath.Join(cgroupPath, "blkio.throttle.io_serviced"))
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	return bytes["Read"], bytes["Write"], ios["Read"], ios["Write"], nil
+}
+
+// readBlkioThrottleFile parses the "<major>:<minor> <Op> <value>" lines
+// blkio.throttle.io_{service_bytes,serviced} use, summing by Op across
+// devices.
+func readBlkioThrottleFile(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	totals := make(map[string]uint64)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		totals[fields[1]] += v
+	}
+	return totals, sc.Err()
+}
@@ -0,0 +1,119 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package cgroup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatalf("unexpected error writing %s: %v", name, err)
+	}
+}
+
+// TestGetStatsV1 exercises getStatsV1 against a realistic v1 layout: each
+// controller mounted in its own directory, the way CreateCgroups actually
+// lays them out, rather than one directory holding every accounting file.
+func TestGetStatsV1(t *testing.T) {
+	root, err := ioutil.TempDir("", "rkt-cgroup-stats-v1-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dirs := map[string]string{
+		"cpu":    filepath.Join(root, "cpu,cpuacct"),
+		"memory": filepath.Join(root, "memory"),
+		"pids":   filepath.Join(root, "pids"),
+		"blkio":  filepath.Join(root, "blkio"),
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	writeTestFile(t, dirs["cpu"], "cpuacct.usage", "123456\n")
+	writeTestFile(t, dirs["cpu"], "cpu.stat", "nr_periods 10\nnr_throttled 2\nthrottled_time 555\n")
+	writeTestFile(t, dirs["memory"], "memory.usage_in_bytes", "1048576\n")
+	writeTestFile(t, dirs["memory"], "memory.stat", "rss 100\ncache 200\nswap 0\n")
+	writeTestFile(t, dirs["pids"], "pids.current", "4\n")
+	writeTestFile(t, dirs["blkio"], "blkio.throttle.io_service_bytes", "8:0 Read 1024\n8:0 Write 2048\n8:0 Total 3072\n")
+	writeTestFile(t, dirs["blkio"], "blkio.throttle.io_serviced", "8:0 Read 5\n8:0 Write 6\n8:0 Total 11\n")
+
+	stats, err := getStatsV1(func(controller string) string { return dirs[controller] })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if stats.CPU.UsageNanos != 123456 {
+		t.Errorf("expected UsageNanos=123456, got %d", stats.CPU.UsageNanos)
+	}
+	if stats.CPU.NrThrottled != 2 || stats.CPU.ThrottledNanos != 555 {
+		t.Errorf("expected NrThrottled=2 ThrottledNanos=555, got %+v", stats.CPU)
+	}
+	if stats.Memory.UsageBytes != 1048576 || stats.Memory.RSSBytes != 100 || stats.Memory.CacheBytes != 200 {
+		t.Errorf("unexpected memory stats: %+v", stats.Memory)
+	}
+	if stats.PIDs != 4 {
+		t.Errorf("expected PIDs=4, got %d", stats.PIDs)
+	}
+	if stats.BlockIO.ReadBytes != 1024 || stats.BlockIO.WriteBytes != 2048 {
+		t.Errorf("unexpected blkio byte stats: %+v", stats.BlockIO)
+	}
+	if stats.BlockIO.ReadIOs != 5 || stats.BlockIO.WriteIOs != 6 {
+		t.Errorf("unexpected blkio IO stats: %+v", stats.BlockIO)
+	}
+}
+
+func TestGetStatsV2(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-cgroup-stats-v2-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	writeTestFile(t, dir, "cpu.stat", "usage_usec 123\nnr_periods 10\nnr_throttled 2\nthrottled_usec 55\n")
+	writeTestFile(t, dir, "memory.current", "2097152\n")
+	writeTestFile(t, dir, "memory.stat", "anon 100\nfile 200\n")
+	writeTestFile(t, dir, "pids.current", "7\n")
+	writeTestFile(t, dir, "io.stat", "8:0 rbytes=1024 wbytes=2048 rios=5 wios=6\n")
+
+	stats, err := getStatsV2(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if stats.CPU.UsageNanos != 123000 {
+		t.Errorf("expected UsageNanos=123000, got %d", stats.CPU.UsageNanos)
+	}
+	if stats.Memory.UsageBytes != 2097152 || stats.Memory.RSSBytes != 100 || stats.Memory.CacheBytes != 200 {
+		t.Errorf("unexpected memory stats: %+v", stats.Memory)
+	}
+	if stats.PIDs != 7 {
+		t.Errorf("expected PIDs=7, got %d", stats.PIDs)
+	}
+	if stats.BlockIO.ReadBytes != 1024 || stats.BlockIO.WriteBytes != 2048 {
+		t.Errorf("unexpected blkio byte stats: %+v", stats.BlockIO)
+	}
+	if stats.BlockIO.ReadIOs != 5 || stats.BlockIO.WriteIOs != 6 {
+		t.Errorf("unexpected blkio IO stats: %+v", stats.BlockIO)
+	}
+}
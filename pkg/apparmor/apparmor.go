@@ -0,0 +1,90 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package apparmor loads AppArmor profiles bundled with a pod's stage1 into
+// the host kernel so apps can be confined with AppArmorProfile= in their
+// systemd service units.
+package apparmor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// ProfileDir is where stage1 expects AppArmor profiles to be staged
+	// before they're loaded into the kernel.
+	ProfileDir = "/etc/rkt/apparmor.d"
+
+	profilesFile = "/sys/kernel/security/apparmor/profiles"
+)
+
+// IsSupported returns whether the host kernel has AppArmor enabled, by
+// checking that the securityfs "profiles" knob exists.
+func IsSupported() bool {
+	_, err := os.Stat(profilesFile)
+	return err == nil
+}
+
+// IsLoaded returns whether a profile with the given name is already loaded
+// into the kernel.
+func IsLoaded(name string) (bool, error) {
+	f, err := os.Open(profilesFile)
+	if err != nil {
+		return false, fmt.Errorf("error opening %q: %v", profilesFile, err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// Each line looks like "<name> (enforce)" or "<name> (complain)".
+		fields := strings.Fields(sc.Text())
+		if len(fields) > 0 && fields[0] == name {
+			return true, nil
+		}
+	}
+	return false, sc.Err()
+}
+
+// LoadProfile loads the named profile from dir into the kernel via
+// apparmor_parser, unless it's already loaded.
+func LoadProfile(dir, name string) error {
+	if strings.ContainsRune(name, filepath.Separator) || strings.Contains(name, "..") {
+		return fmt.Errorf("invalid AppArmor profile name %q", name)
+	}
+
+	loaded, err := IsLoaded(name)
+	if err != nil {
+		return err
+	}
+	if loaded {
+		return nil
+	}
+
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("error finding AppArmor profile %q: %v", name, err)
+	}
+
+	cmd := exec.Command("apparmor_parser", "-r", "-W", path)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error loading AppArmor profile %q: %v: %s", name, err, out)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seccomp
+
+// defaultProfiles holds the profiles bundled with stage1. "default" is a
+// curated whitelist similar to Docker's default seccomp profile, trimmed to
+// the syscalls a typical container workload needs. "unconfined" disables
+// filtering entirely and is handled specially by callers.
+var defaultProfiles = map[string]*Profile{
+	DefaultProfile: {
+		Syscalls: []string{
+			"accept", "accept4", "access", "arch_prctl", "bind", "brk",
+			"capget", "capset", "chdir", "chmod", "chown", "clock_getres",
+			"clock_gettime", "clone", "close", "connect", "dup", "dup2",
+			"dup3", "epoll_create", "epoll_create1", "epoll_ctl", "epoll_wait",
+			"execve", "exit", "exit_group", "fchdir", "fchmod", "fchown",
+			"fcntl", "fdatasync", "fstat", "fsync", "ftruncate", "futex",
+			"getcwd", "getdents", "getdents64", "getegid", "geteuid",
+			"getgid", "getgroups", "getpeername", "getpgrp", "getpid",
+			"getppid", "getrandom", "getresgid", "getresuid", "getrlimit",
+			"getsockname", "getsockopt", "gettid", "gettimeofday", "getuid",
+			"ioctl", "kill", "link", "listen", "lseek", "lstat", "madvise",
+			"mkdir", "mmap", "mprotect", "munmap", "nanosleep", "open",
+			"openat", "pipe", "pipe2", "poll", "prctl", "pread64", "pselect6",
+			"pwrite64", "read", "readlink", "readv", "recvfrom", "recvmsg",
+			"rename", "rmdir", "rt_sigaction", "rt_sigprocmask",
+			"rt_sigreturn", "sched_yield", "sendmsg", "sendto",
+			"set_robust_list", "set_tid_address", "setgid", "setgroups",
+			"setsockopt", "setuid", "shutdown", "sigaltstack", "socket",
+			"socketpair", "stat", "statfs", "symlink", "sysinfo", "umask",
+			"uname", "unlink", "wait4", "write", "writev",
+		},
+	},
+}
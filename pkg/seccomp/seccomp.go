@@ -0,0 +1,117 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package seccomp implements loading of named seccomp filter profiles used
+// by stage1 to translate the rkt-specific seccomp isolators into systemd
+// SystemCallFilter= directives.
+package seccomp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// RetainSetIsolatorName requests a whitelist of syscalls: everything not
+	// in the named profile (plus any syscalls listed in Syscalls) is denied.
+	RetainSetIsolatorName = "os/linux/seccomp-retain-set"
+	// RemoveSetIsolatorName requests a blacklist of syscalls: everything in
+	// the named profile (plus any syscalls listed in Syscalls) is denied,
+	// everything else is allowed.
+	RemoveSetIsolatorName = "os/linux/seccomp-remove-set"
+
+	// UnconfinedProfile disables seccomp filtering entirely.
+	UnconfinedProfile = "unconfined"
+	// DefaultProfile is the name of the curated whitelist bundled with
+	// stage1, modeled after Docker's default seccomp profile.
+	DefaultProfile = "default"
+
+	// ProfileDir is where stage1 ships its on-disk profiles, one JSON file
+	// per profile named "<profile>.json".
+	ProfileDir = "/etc/rkt/seccomp"
+
+	// ErrnoDefault is used in SystemCallErrorNumber= when a profile doesn't
+	// specify one explicitly.
+	ErrnoDefault = "EPERM"
+)
+
+// Isolator is the JSON value of a seccomp-retain-set/seccomp-remove-set
+// isolator.
+type Isolator struct {
+	// Profile names a bundled or on-disk profile ("default" or
+	// "unconfined") to use as the base set. Defaults to "default".
+	Profile string `json:"profile,omitempty"`
+	// Syscalls is an additional, explicit list of syscall names layered on
+	// top of Profile.
+	Syscalls []string `json:"syscalls,omitempty"`
+	// Errno overrides the errno returned for denied syscalls. Defaults to
+	// EPERM.
+	Errno string `json:"errno,omitempty"`
+}
+
+// Profile is an on-disk, JSON-encoded seccomp whitelist.
+type Profile struct {
+	Syscalls []string `json:"syscalls"`
+}
+
+// LoadProfile loads a named profile. "default" (also used for an empty name)
+// is resolved from the bundled set; any other name, "unconfined" included, is
+// read from dir as "<name>.json".
+func LoadProfile(dir, name string) (*Profile, error) {
+	if name == "" {
+		name = DefaultProfile
+	}
+	if p, ok := defaultProfiles[name]; ok {
+		return p, nil
+	}
+	if strings.ContainsRune(name, filepath.Separator) || strings.Contains(name, "..") {
+		return nil, fmt.Errorf("invalid seccomp profile name %q", name)
+	}
+
+	path := filepath.Join(dir, name+".json")
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading seccomp profile %q: %v", name, err)
+	}
+
+	var p Profile
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("error parsing seccomp profile %q: %v", name, err)
+	}
+	return &p, nil
+}
+
+// ResolveSyscalls resolves the isolator to the final, de-duplicated list of
+// syscalls that make up its profile plus any explicitly-listed extras.
+func (i *Isolator) ResolveSyscalls(dir string) ([]string, error) {
+	p, err := LoadProfile(dir, i.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(p.Syscalls)+len(i.Syscalls))
+	var out []string
+	for _, lists := range [][]string{p.Syscalls, i.Syscalls} {
+		for _, s := range lists {
+			if !seen[s] {
+				seen[s] = true
+				out = append(out, s)
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seccomp
+
+import "testing"
+
+func TestResolveSyscallsDedup(t *testing.T) {
+	iso := &Isolator{
+		Profile:  DefaultProfile,
+		Syscalls: []string{"accept", "perf_event_open"},
+	}
+
+	syscalls, err := iso.ResolveSyscalls("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	seen := make(map[string]int)
+	for _, s := range syscalls {
+		seen[s]++
+	}
+	if seen["accept"] != 1 {
+		t.Errorf("expected %q to appear exactly once, got %d", "accept", seen["accept"])
+	}
+	if seen["perf_event_open"] != 1 {
+		t.Errorf("expected extra syscall %q to be present", "perf_event_open")
+	}
+}
+
+func TestResolveSyscallsUnknownProfile(t *testing.T) {
+	iso := &Isolator{Profile: "does-not-exist"}
+	if _, err := iso.ResolveSyscalls("/nonexistent-dir"); err == nil {
+		t.Error("expected an error loading an unknown profile, got nil")
+	}
+}
+
+func TestLoadProfileRejectsPathTraversal(t *testing.T) {
+	for _, name := range []string{"../../etc/passwd", "sub/profile", "/etc/passwd"} {
+		if _, err := LoadProfile("/some/profiles/dir", name); err == nil {
+			t.Errorf("expected an error loading profile name %q, got nil", name)
+		}
+	}
+}
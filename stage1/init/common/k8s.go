@@ -0,0 +1,191 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package common
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/appc/spec/schema"
+	"github.com/appc/spec/schema/types"
+
+	corev1 "github.com/coreos/rkt/Godeps/_workspace/src/k8s.io/api/core/v1"
+)
+
+// UnsupportedFieldError lists the PodSpec fields K8sPodToRktPod couldn't
+// translate, so callers can decide whether to proceed or abort.
+type UnsupportedFieldError struct {
+	Fields []string
+}
+
+func (e *UnsupportedFieldError) Error() string {
+	return fmt.Sprintf("unsupported PodSpec fields: %s", strings.Join(e.Fields, ", "))
+}
+
+// k8sRestartPolicyAnnotationName carries spec.RestartPolicy through to
+// appToSystemd in pod.go, which has no other way to see the PodSpec this
+// RuntimeApp came from.
+const k8sRestartPolicyAnnotationName = "coreos.com/rkt/stage1/k8s-restart-policy"
+
+// K8sPodToRktPod translates a Kubernetes PodSpec into an appc PodManifest
+// rkt can run. It covers containers, env, emptyDir/hostPath volumes,
+// capability add/drop, cpu/memory resource limits, working directory, and
+// restart policy. Anything else (probes, lifecycle hooks, configMap/secret
+// volumes, valueFrom of any kind including the downward API, ...) is
+// reported back via UnsupportedFieldError rather than silently dropped.
+func K8sPodToRktPod(spec *corev1.PodSpec) (*schema.PodManifest, error) {
+	pm := &schema.PodManifest{
+		ACKind:    schema.PodManifestKind,
+		ACVersion: schema.AppContainerVersion,
+	}
+
+	var unsupported []string
+
+	for _, v := range spec.Volumes {
+		vol, skip, err := k8sVolumeToRktVolume(v)
+		if err != nil {
+			return nil, err
+		}
+		if skip != "" {
+			unsupported = append(unsupported, skip)
+			continue
+		}
+		pm.Volumes = append(pm.Volumes, *vol)
+	}
+
+	for _, c := range spec.Containers {
+		ra, fields, err := k8sContainerToRuntimeApp(c, spec)
+		if err != nil {
+			return nil, err
+		}
+		unsupported = append(unsupported, fields...)
+		pm.Apps = append(pm.Apps, *ra)
+	}
+
+	if len(spec.InitContainers) > 0 {
+		unsupported = append(unsupported, "initContainers")
+	}
+
+	if len(unsupported) > 0 {
+		return pm, &UnsupportedFieldError{Fields: unsupported}
+	}
+
+	return pm, nil
+}
+
+func k8sVolumeToRktVolume(v corev1.Volume) (vol *types.Volume, unsupported string, err error) {
+	name, err := types.NewACName(v.Name)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid volume name %q: %v", v.Name, err)
+	}
+
+	switch {
+	case v.EmptyDir != nil:
+		return &types.Volume{Name: *name, Kind: "empty"}, "", nil
+	case v.HostPath != nil:
+		return &types.Volume{Name: *name, Kind: "host", Source: v.HostPath.Path}, "", nil
+	default:
+		return nil, fmt.Sprintf("volumes[%s]: only emptyDir and hostPath are supported", v.Name), nil
+	}
+}
+
+func k8sContainerToRuntimeApp(c corev1.Container, spec *corev1.PodSpec) (*schema.RuntimeApp, []string, error) {
+	var unsupported []string
+
+	name, err := types.NewACName(c.Name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid container name %q: %v", c.Name, err)
+	}
+
+	app := &types.App{
+		Exec:             c.Command,
+		WorkingDirectory: c.WorkingDir,
+		User:             "0",
+		Group:            "0",
+	}
+	app.Exec = append(app.Exec, c.Args...)
+
+	for _, e := range c.Env {
+		if e.ValueFrom != nil {
+			// Resolving this against the pod's actual metadata/status
+			// would require plumbing an ObjectMeta/PodStatus into this
+			// function, which only sees the PodSpec; report it rather
+			// than setting the env var to the unresolved field path.
+			unsupported = append(unsupported, fmt.Sprintf("containers[%s].env[%s].valueFrom", c.Name, e.Name))
+			continue
+		}
+		app.Environment.Set(e.Name, e.Value)
+	}
+
+	if c.SecurityContext != nil && c.SecurityContext.Capabilities != nil {
+		caps := c.SecurityContext.Capabilities
+		if len(caps.Add) > 0 {
+			names := make([]string, len(caps.Add))
+			for i, cp := range caps.Add {
+				names[i] = "CAP_" + strings.ToUpper(string(cp))
+			}
+			retain, err := types.NewLinuxCapabilitiesRetainSet(names...)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid capabilities for %q: %v", c.Name, err)
+			}
+			app.Isolators = append(app.Isolators, retain.AsIsolator())
+		}
+		if len(caps.Drop) > 0 {
+			names := make([]string, len(caps.Drop))
+			for i, cp := range caps.Drop {
+				names[i] = "CAP_" + strings.ToUpper(string(cp))
+			}
+			revoke, err := types.NewLinuxCapabilitiesRevokeSet(names...)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid capabilities for %q: %v", c.Name, err)
+			}
+			app.Isolators = append(app.Isolators, revoke.AsIsolator())
+		}
+	}
+
+	if mem, ok := c.Resources.Limits[corev1.ResourceMemory]; ok {
+		iso, err := types.NewResourceMemoryIsolator(mem.String(), mem.String())
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid memory limit for %q: %v", c.Name, err)
+		}
+		app.Isolators = append(app.Isolators, iso.AsIsolator())
+	}
+	if cpu, ok := c.Resources.Limits[corev1.ResourceCPU]; ok {
+		iso, err := types.NewResourceCPUIsolator(cpu.String(), cpu.String())
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid cpu limit for %q: %v", c.Name, err)
+		}
+		app.Isolators = append(app.Isolators, iso.AsIsolator())
+	}
+
+	if c.LivenessProbe != nil || c.ReadinessProbe != nil {
+		unsupported = append(unsupported, fmt.Sprintf("containers[%s].livenessProbe/readinessProbe", c.Name))
+	}
+	if c.Lifecycle != nil {
+		unsupported = append(unsupported, fmt.Sprintf("containers[%s].lifecycle", c.Name))
+	}
+
+	ra := &schema.RuntimeApp{
+		Name: *name,
+		App:  app,
+		Annotations: types.Annotations{
+			{Name: k8sRestartPolicyAnnotationName, Value: string(spec.RestartPolicy)},
+		},
+	}
+
+	return ra, unsupported, nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package common
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "github.com/coreos/rkt/Godeps/_workspace/src/k8s.io/api/core/v1"
+)
+
+func TestK8sPodToRktPodBasic(t *testing.T) {
+	spec := &corev1.PodSpec{
+		RestartPolicy: corev1.RestartPolicyAlways,
+		Volumes: []corev1.Volume{
+			{Name: "data", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+		},
+		Containers: []corev1.Container{
+			{
+				Name:    "app",
+				Command: []string{"/bin/app"},
+				Env: []corev1.EnvVar{
+					{Name: "FOO", Value: "bar"},
+				},
+			},
+		},
+	}
+
+	pm, err := K8sPodToRktPod(spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pm.Volumes) != 1 || pm.Volumes[0].Kind != "empty" {
+		t.Errorf("expected one empty volume, got %+v", pm.Volumes)
+	}
+	if len(pm.Apps) != 1 {
+		t.Fatalf("expected one app, got %d", len(pm.Apps))
+	}
+
+	ra := pm.Apps[0]
+	if ra.Name.String() != "app" {
+		t.Errorf("expected app name %q, got %q", "app", ra.Name.String())
+	}
+	if v, ok := ra.App.Environment.Get("FOO"); !ok || v != "bar" {
+		t.Errorf("expected FOO=bar, got %q (ok=%v)", v, ok)
+	}
+	policy, ok := ra.Annotations.Get(k8sRestartPolicyAnnotationName)
+	if !ok || policy != "Always" {
+		t.Errorf("expected restart-policy annotation %q, got %q (ok=%v)", "Always", policy, ok)
+	}
+}
+
+func TestK8sPodToRktPodDownwardAPIIsUnsupported(t *testing.T) {
+	spec := &corev1.PodSpec{
+		Containers: []corev1.Container{
+			{
+				Name: "app",
+				Env: []corev1.EnvVar{
+					{
+						Name: "POD_NAME",
+						ValueFrom: &corev1.EnvVarSource{
+							FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	pm, err := K8sPodToRktPod(spec)
+	uerr, ok := err.(*UnsupportedFieldError)
+	if !ok {
+		t.Fatalf("expected an UnsupportedFieldError, got %v", err)
+	}
+	found := false
+	for _, f := range uerr.Fields {
+		if strings.Contains(f, "valueFrom") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected a valueFrom entry in unsupported fields, got %v", uerr.Fields)
+	}
+	if len(pm.Apps) != 1 {
+		t.Fatalf("expected one app, got %d", len(pm.Apps))
+	}
+	if _, ok := pm.Apps[0].App.Environment.Get("POD_NAME"); ok {
+		t.Error("expected POD_NAME to be left unset rather than given a literal field path")
+	}
+}
+
+func TestSystemdRestartForK8sPolicy(t *testing.T) {
+	cases := []struct {
+		policy  string
+		restart string
+		ok      bool
+	}{
+		{"Always", "always", true},
+		{"OnFailure", "on-failure", true},
+		{"Never", "no", true},
+		{"", "", false},
+		{"Unknown", "", false},
+	}
+	for _, c := range cases {
+		restart, ok := systemdRestartForK8sPolicy(c.policy)
+		if restart != c.restart || ok != c.ok {
+			t.Errorf("systemdRestartForK8sPolicy(%q) = (%q, %v), expected (%q, %v)", c.policy, restart, ok, c.restart, c.ok)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package common
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appc/spec/schema/types"
+	"github.com/coreos/go-systemd/unit"
+	"github.com/coreos/rkt/pkg/seccomp"
+)
+
+func rawIsolator(t *testing.T, name string, v seccomp.Isolator) types.Isolator {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("unexpected error marshaling isolator value: %v", err)
+	}
+	raw := json.RawMessage(b)
+	return types.Isolator{Name: types.ACIdentifier(name), ValueRaw: &raw}
+}
+
+func TestAddSeccompFilterRetainSet(t *testing.T) {
+	i := rawIsolator(t, seccomp.RetainSetIsolatorName, seccomp.Isolator{
+		Profile:  seccomp.DefaultProfile,
+		Syscalls: []string{"accept"},
+	})
+
+	opts, err := addSeccompFilter(nil, i)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	found := false
+	for _, o := range opts {
+		if o.Name == "SystemCallFilter" {
+			found = true
+			if strings.HasPrefix(o.Value, "~") {
+				t.Errorf("retain set must not be negated, got %q", o.Value)
+			}
+			if !strings.Contains(o.Value, "accept") {
+				t.Errorf("expected filter to contain %q, got %q", "accept", o.Value)
+			}
+		}
+	}
+	if !found {
+		t.Error("expected a SystemCallFilter= unit option")
+	}
+}
+
+func TestAddSeccompFilterRemoveSet(t *testing.T) {
+	i := rawIsolator(t, seccomp.RemoveSetIsolatorName, seccomp.Isolator{
+		Profile:  seccomp.DefaultProfile,
+		Syscalls: []string{"accept"},
+	})
+
+	opts, err := addSeccompFilter(nil, i)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	found := false
+	for _, o := range opts {
+		if o.Name == "SystemCallFilter" {
+			found = true
+			if !strings.HasPrefix(o.Value, "~") {
+				t.Errorf("remove set must be negated with '~', got %q", o.Value)
+			}
+		}
+	}
+	if !found {
+		t.Error("expected a SystemCallFilter= unit option")
+	}
+}
+
+func TestSocketOwnerOptions(t *testing.T) {
+	portName := types.ACName("web")
+	b, err := json.Marshal(socketOptions{Mode: "0660", MaxConnections: 5, KeepAlive: true})
+	if err != nil {
+		t.Fatalf("unexpected error marshaling socket options: %v", err)
+	}
+	annotations := types.Annotations{
+		{Name: types.ACIdentifier(socketOptionsAnnotationPrefix + portName.String()), Value: string(b)},
+	}
+
+	opts := socketOwnerOptions(annotations, portName)
+
+	if v, ok := findUnitOption(opts, "SocketMode"); !ok || v != "0660" {
+		t.Errorf("expected SocketMode=0660, got %q (found=%v)", v, ok)
+	}
+	if v, ok := findUnitOption(opts, "MaxConnections"); !ok || v != "5" {
+		t.Errorf("expected MaxConnections=5, got %q (found=%v)", v, ok)
+	}
+	if v, ok := findUnitOption(opts, "KeepAlive"); !ok || v != "yes" {
+		t.Errorf("expected KeepAlive=yes, got %q (found=%v)", v, ok)
+	}
+}
+
+func TestEnsureSocketDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rkt-socket-dir-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	socketPath := filepath.Join(dir, "rkt", "sockets", "web")
+
+	if err := ensureSocketDir(socketPath); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Dir(socketPath))
+	if err != nil {
+		t.Fatalf("expected socket directory to exist: %v", err)
+	}
+	if !info.IsDir() {
+		t.Errorf("expected %q to be a directory", filepath.Dir(socketPath))
+	}
+}
+
+func TestGetHealthCheckDefaults(t *testing.T) {
+	b, err := json.Marshal(healthCheck{Exec: []string{"/bin/check"}})
+	if err != nil {
+		t.Fatalf("unexpected error marshaling isolator value: %v", err)
+	}
+	raw := json.RawMessage(b)
+	isolators := types.Isolators{{Name: types.ACIdentifier(healthCheckIsolatorName), ValueRaw: &raw}}
+
+	hc, err := getHealthCheck(isolators)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hc == nil {
+		t.Fatal("expected a non-nil health check")
+	}
+	if hc.IntervalSeconds != 10 || hc.FailureThreshold != 3 {
+		t.Errorf("expected default interval=10 threshold=3, got interval=%d threshold=%d", hc.IntervalSeconds, hc.FailureThreshold)
+	}
+}
+
+func TestAddHealthCheckOptionsExecConditionGating(t *testing.T) {
+	hc := &healthCheck{Exec: []string{"/bin/check"}, IntervalSeconds: 5, FailureThreshold: 2}
+
+	newOpts := addHealthCheckOptions(nil, hc, 243)
+	if _, ok := findUnitOption(newOpts, "ExecCondition"); !ok {
+		t.Error("expected ExecCondition= on systemd 243")
+	}
+
+	oldOpts := addHealthCheckOptions(nil, hc, 219)
+	if _, ok := findUnitOption(oldOpts, "ExecStartPre"); !ok {
+		t.Error("expected ExecStartPre= fallback on systemd 219")
+	}
+}
+
+func findUnitOption(opts []*unit.UnitOption, name string) (string, bool) {
+	for _, o := range opts {
+		if o.Name == name {
+			return o.Value, true
+		}
+	}
+	return "", false
+}
+
+func TestAddHardeningOptionsDefault(t *testing.T) {
+	opts, err := addHardeningOptions(nil, types.Isolators{}, nil, nil, 231)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, want := range []string{"NoNewPrivileges", "PrivateTmp", "ProtectSystem", "ProtectHome", "ProtectKernelTunables", "ProtectKernelModules", "ProtectControlGroups", "PrivateDevices", "RestrictAddressFamilies", "RestrictSUIDSGID", "LockPersonality", "MemoryDenyWriteExecute", "SystemCallFilter"} {
+		found := false
+		for _, o := range opts {
+			if o.Name == want {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected a %s= unit option by default", want)
+		}
+	}
+}
+
+func TestAddHardeningOptionsOldSystemd(t *testing.T) {
+	opts, err := addHardeningOptions(nil, types.Isolators{}, nil, nil, 219)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, o := range opts {
+		if o.Name == "ProtectSystem" {
+			t.Errorf("did not expect ProtectSystem= on systemd 219, got it")
+		}
+	}
+}
+
+func TestAddHardeningOptionsDisabled(t *testing.T) {
+	b, err := json.Marshal(sandboxProfile{Disable: true})
+	if err != nil {
+		t.Fatalf("unexpected error marshaling isolator value: %v", err)
+	}
+	raw := json.RawMessage(b)
+	isolators := types.Isolators{{Name: types.ACIdentifier(sandboxProfileIsolatorName), ValueRaw: &raw}}
+
+	opts, err := addHardeningOptions(nil, isolators, nil, nil, 231)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(opts) != 0 {
+		t.Errorf("expected no hardening options when disabled, got %v", opts)
+	}
+}
+
+func TestAddHardeningOptionsNoHardeningIsolator(t *testing.T) {
+	isolators := types.Isolators{{Name: types.ACIdentifier(noHardeningIsolatorName)}}
+
+	opts, err := addHardeningOptions(nil, isolators, nil, nil, 231)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(opts) != 0 {
+		t.Errorf("expected no hardening options with the no-hardening isolator, got %v", opts)
+	}
+}
+
+func TestAddHardeningOptionsRespectsCapabilitiesAndMounts(t *testing.T) {
+	mountPoints := types.MountPoints{{Path: "/tmp"}}
+
+	opts, err := addHardeningOptions(nil, types.Isolators{}, []string{"CAP_SYS_ADMIN"}, mountPoints, 231)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := findUnitOption(opts, "NoNewPrivileges"); ok {
+		t.Error("did not expect NoNewPrivileges= when the app retains CAP_SYS_ADMIN")
+	}
+	if _, ok := findUnitOption(opts, "PrivateTmp"); ok {
+		t.Error("did not expect PrivateTmp= when the app mounts something at /tmp")
+	}
+}
+
+func TestGetAppCapabilitySetsBoundingIsRetainMinusRevoke(t *testing.T) {
+	retain, err := types.NewLinuxCapabilitiesRetainSet("CAP_SYS_ADMIN", "CAP_NET_ADMIN")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	revoke, err := types.NewLinuxCapabilitiesRevokeSet("CAP_NET_ADMIN")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	isolators := types.Isolators{retain.AsIsolator(), revoke.AsIsolator()}
+
+	capSets, err := GetAppCapabilitySets(isolators)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(capSets.Bounding) != 1 || capSets.Bounding[0] != "CAP_SYS_ADMIN" {
+		t.Errorf("expected bounding set [CAP_SYS_ADMIN], got %v", capSets.Bounding)
+	}
+}
+
+func TestAddHugetlbIsolatorDoesNotError(t *testing.T) {
+	b, err := json.Marshal(hugetlbIsolator{PageSize: "2MB", Limit: 1048576})
+	if err != nil {
+		t.Fatalf("unexpected error marshaling isolator value: %v", err)
+	}
+	raw := json.RawMessage(b)
+	i := types.Isolator{Name: types.ACIdentifier(hugetlbIsolatorName), ValueRaw: &raw}
+
+	// addHugetlbIsolator can't apply the limit without a cgroup path to
+	// write it to, so this only checks it degrades to a warning instead of
+	// an error.
+	if err := addHugetlbIsolator(i); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestGetAppCapabilitiesReturnsBoundingSet(t *testing.T) {
+	retain, err := types.NewLinuxCapabilitiesRetainSet("CAP_SYS_ADMIN", "CAP_NET_ADMIN")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	revoke, err := types.NewLinuxCapabilitiesRevokeSet("CAP_NET_ADMIN")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	isolators := types.Isolators{retain.AsIsolator(), revoke.AsIsolator()}
+
+	caps, err := GetAppCapabilities(isolators)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(caps) != 1 || caps[0] != "CAP_SYS_ADMIN" {
+		t.Errorf("expected [CAP_SYS_ADMIN], got %v", caps)
+	}
+}
+
+func TestGetAppCapabilitySetsAmbientMustBeInheritable(t *testing.T) {
+	ambient, err := json.Marshal(capabilitiesSetIsolator{Set: []string{"CAP_NET_BIND_SERVICE"}})
+	if err != nil {
+		t.Fatalf("unexpected error marshaling isolator value: %v", err)
+	}
+	ambientRaw := json.RawMessage(ambient)
+	isolators := types.Isolators{
+		{Name: types.ACIdentifier(capabilitiesAmbientSetIsolatorName), ValueRaw: &ambientRaw},
+	}
+
+	if _, err := GetAppCapabilitySets(isolators); err == nil {
+		t.Error("expected an error when the ambient set is not a subset of the inheritable set")
+	}
+}
+
+func TestGetAppCapabilitySetsInheritableMustBeBounding(t *testing.T) {
+	inheritable, err := json.Marshal(capabilitiesSetIsolator{Set: []string{"CAP_SYS_ADMIN"}})
+	if err != nil {
+		t.Fatalf("unexpected error marshaling isolator value: %v", err)
+	}
+	inheritableRaw := json.RawMessage(inheritable)
+	isolators := types.Isolators{
+		{Name: types.ACIdentifier(capabilitiesInheritableSetIsolatorName), ValueRaw: &inheritableRaw},
+	}
+
+	if _, err := GetAppCapabilitySets(isolators); err == nil {
+		t.Error("expected an error when the inheritable set is not a subset of the bounding set")
+	}
+}
+
+func TestAddAppArmorProfileUnsupportedHost(t *testing.T) {
+	// The test environment has no securityfs mounted, so AppArmor support
+	// detection must fall back to leaving opts untouched rather than error.
+	b, err := json.Marshal(appArmorIsolator{Name: "rkt-default"})
+	if err != nil {
+		t.Fatalf("unexpected error marshaling isolator value: %v", err)
+	}
+	raw := json.RawMessage(b)
+	i := types.Isolator{Name: types.ACIdentifier(appArmorProfileIsolatorName), ValueRaw: &raw}
+
+	opts, err := addAppArmorProfile(nil, i)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(opts) != 0 {
+		t.Errorf("expected no unit options when AppArmor is unsupported, got %v", opts)
+	}
+}
+
+func TestAddSeccompFilterUnconfined(t *testing.T) {
+	i := rawIsolator(t, seccomp.RetainSetIsolatorName, seccomp.Isolator{
+		Profile: seccomp.UnconfinedProfile,
+	})
+
+	opts, err := addSeccompFilter(nil, i)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(opts) != 0 {
+		t.Errorf("expected no unit options for unconfined profile, got %v", opts)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package common
+
+import (
+	"fmt"
+	"path/filepath"
+	"syscall"
+
+	"github.com/appc/spec/schema"
+	"github.com/appc/spec/schema/types"
+
+	"github.com/coreos/rkt/common"
+	stage1commontypes "github.com/coreos/rkt/stage1/common/types"
+)
+
+// mountPropagationAnnotationPrefix and mountRecursiveAnnotationPrefix are set
+// per-volume on the pod manifest to request mount(2) propagation behavior
+// that --bind=/--bind-ro= alone can't express, e.g.
+// "coreos.com/rkt/stage1/volume-propagation/data"="rshared".
+const (
+	mountPropagationAnnotationPrefix = "coreos.com/rkt/stage1/volume-propagation/"
+	mountRecursiveAnnotationPrefix   = "coreos.com/rkt/stage1/volume-recursive/"
+)
+
+// mountPropagationModes maps the propagation modes accepted on a volume
+// annotation to the mount(2) flags that implement them.
+var mountPropagationModes = map[string]uintptr{
+	"private":  syscall.MS_PRIVATE,
+	"rprivate": syscall.MS_PRIVATE | syscall.MS_REC,
+	"shared":   syscall.MS_SHARED,
+	"rshared":  syscall.MS_SHARED | syscall.MS_REC,
+	"slave":    syscall.MS_SLAVE,
+	"rslave":   syscall.MS_SLAVE | syscall.MS_REC,
+}
+
+// mountPropagationMode returns the requested propagation mode for a volume,
+// if any, and whether it's one of the modes mountPropagationModes knows
+// about.
+func mountPropagationMode(annotations types.Annotations, volName types.ACName) (mode string, ok bool) {
+	v, ok := annotations.Get(types.ACIdentifier(mountPropagationAnnotationPrefix + volName.String()))
+	if !ok {
+		return "", false
+	}
+	if _, known := mountPropagationModes[v]; !known {
+		return "", false
+	}
+	return v, true
+}
+
+// mountRecursiveMode reports whether a volume requested a recursive bind
+// mount (--bind=SRC:DST:rbind), which submounts nested under SRC on the
+// host.
+func mountRecursiveMode(annotations types.Annotations, volName types.ACName) bool {
+	v, ok := annotations.Get(types.ACIdentifier(mountRecursiveAnnotationPrefix + volName.String()))
+	return ok && v == "true"
+}
+
+// AdjustMountPropagation changes the propagation type of an already-mounted
+// path to one of "private", "rprivate", "shared", "rshared", "slave", or
+// "rslave", via a propagation-only mount(2) remount (empty source and
+// fstype). It's meant to be called against the app's bind-mounted target
+// once nspawn has actually performed the bind, since --bind=SRC:DST:rbind
+// alone can't request shared or slave propagation.
+func AdjustMountPropagation(target, mode string) error {
+	flags, ok := mountPropagationModes[mode]
+	if !ok {
+		return fmt.Errorf("unknown mount propagation mode %q", mode)
+	}
+	if err := syscall.Mount("", target, "", flags, ""); err != nil {
+		return fmt.Errorf("error adjusting mount propagation of %q to %q: %v", target, mode, err)
+	}
+	return nil
+}
+
+// MountPropagationAdjustment pairs a bind-mounted app path with the
+// propagation mode it should be switched to once nspawn has performed the
+// bind.
+type MountPropagationAdjustment struct {
+	Path string
+	Mode string
+}
+
+// GetMountPropagationAdjustments returns the propagation adjustments an app's
+// volumes requested via mountPropagationAnnotationPrefix. --bind=SRC:DST[:rbind]
+// alone can only ever produce private propagation, so shared/slave modes
+// need a second mount(2) call against the bind target from inside the pod's
+// mount namespace once nspawn has started it; the stage1 supervisor is
+// expected to call AdjustMountPropagation for each entry this returns.
+func GetMountPropagationAdjustments(p *stage1commontypes.Pod, ra *schema.RuntimeApp) ([]MountPropagationAdjustment, error) {
+	appName := ra.Name
+
+	vols := make(map[types.ACName]types.Volume)
+	for _, v := range p.Manifest.Volumes {
+		vols[v.Name] = v
+	}
+
+	absRoot, err := filepath.Abs(p.Root)
+	if err != nil {
+		return nil, fmt.Errorf("could not get pod's root absolute path: %v", err)
+	}
+	appRootfs := common.AppRootfsPath(absRoot, appName)
+
+	imageManifest := p.Images[appName.String()]
+	mounts := GenerateMounts(ra, vols, imageManifest)
+
+	var adjustments []MountPropagationAdjustment
+	for _, m := range mounts {
+		vol := vols[m.Volume]
+
+		mode, ok := mountPropagationMode(p.Manifest.Annotations, vol.Name)
+		if !ok {
+			continue
+		}
+
+		mntPath, err := evaluateSymlinksInsideApp(appRootfs, m.Path)
+		if err != nil {
+			return nil, fmt.Errorf("could not evaluate path %v: %v", m.Path, err)
+		}
+
+		adjustments = append(adjustments, MountPropagationAdjustment{
+			Path: filepath.Join(appRootfs, mntPath),
+			Mode: mode,
+		})
+	}
+
+	return adjustments, nil
+}
+
+// The KVM flavor has no bind mounts to adjust propagation on at all: volumes
+// are shared into the guest over 9p/virtio-fs, configured on the qemu/lkvm
+// command line rather than through nspawn args. Translating Propagation and
+// Recursive into the equivalent share attributes belongs in stage1/init/kvm,
+// which isn't part of this tree.
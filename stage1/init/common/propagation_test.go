@@ -0,0 +1,180 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/appc/spec/schema/types"
+)
+
+// isMountpoint reports whether path is itself a mount rather than a plain
+// directory inside its parent's filesystem, by comparing device numbers.
+func isMountpoint(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	parentInfo, err := os.Stat(filepath.Dir(path))
+	if err != nil {
+		return false, err
+	}
+	dev := info.Sys().(*syscall.Stat_t).Dev
+	parentDev := parentInfo.Sys().(*syscall.Stat_t).Dev
+	return dev != parentDev, nil
+}
+
+func TestMountPropagationModeRshared(t *testing.T) {
+	volName := types.ACName("data")
+	annotations := types.Annotations{
+		{Name: types.ACIdentifier(mountPropagationAnnotationPrefix + volName.String()), Value: "rshared"},
+	}
+
+	mode, ok := mountPropagationMode(annotations, volName)
+	if !ok || mode != "rshared" {
+		t.Errorf("expected mode=rshared ok=true, got mode=%q ok=%v", mode, ok)
+	}
+}
+
+func TestMountPropagationModeDefaultsToPrivate(t *testing.T) {
+	volName := types.ACName("data")
+
+	if _, ok := mountPropagationMode(types.Annotations{}, volName); ok {
+		t.Error("expected no propagation mode when no annotation is set, so the mount stays private")
+	}
+}
+
+func TestMountPropagationModeRejectsUnknownValue(t *testing.T) {
+	volName := types.ACName("data")
+	annotations := types.Annotations{
+		{Name: types.ACIdentifier(mountPropagationAnnotationPrefix + volName.String()), Value: "bogus"},
+	}
+
+	if _, ok := mountPropagationMode(annotations, volName); ok {
+		t.Error("expected an unknown propagation mode to be rejected")
+	}
+}
+
+func TestMountRecursiveMode(t *testing.T) {
+	volName := types.ACName("data")
+	annotations := types.Annotations{
+		{Name: types.ACIdentifier(mountRecursiveAnnotationPrefix + volName.String()), Value: "true"},
+	}
+
+	if !mountRecursiveMode(annotations, volName) {
+		t.Error("expected recursive mode to be true")
+	}
+	if mountRecursiveMode(types.Annotations{}, volName) {
+		t.Error("expected recursive mode to default to false")
+	}
+}
+
+func TestAdjustMountPropagationRejectsUnknownMode(t *testing.T) {
+	if err := AdjustMountPropagation("/tmp", "bogus"); err == nil {
+		t.Error("expected an error for an unknown propagation mode")
+	}
+}
+
+// TestAdjustMountPropagationBehavior exercises AdjustMountPropagation's
+// actual effect on the kernel: with "rshared" set on a mountpoint, a mount
+// made under it later is visible through a second, independent bind mount
+// of that same mountpoint; with "private" set, it isn't. This needs its own
+// mount namespace and CAP_SYS_ADMIN, so it skips rather than fails when the
+// environment running the tests can't provide either.
+func TestAdjustMountPropagationBehavior(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to create mount namespaces")
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if err := syscall.Unshare(syscall.CLONE_NEWNS); err != nil {
+		t.Skipf("mount namespaces unavailable in this test environment: %v", err)
+	}
+
+	root, err := ioutil.TempDir("", "rkt-propagation-behavior-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	shared := filepath.Join(root, "shared")
+	bound := filepath.Join(root, "bound")
+	for _, d := range []string{shared, bound} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// shared needs to be a mountpoint of its own before its propagation can
+	// be adjusted independently of its parent.
+	if err := syscall.Mount("tmpfs", shared, "tmpfs", 0, ""); err != nil {
+		t.Skipf("could not mount tmpfs in this test environment: %v", err)
+	}
+	defer syscall.Unmount(shared, syscall.MNT_DETACH)
+
+	// shared is made rshared before bound is created, so the bind below
+	// joins its peer group.
+	if err := AdjustMountPropagation(shared, "rshared"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// bound is a second, independent view of shared, the way a sibling app's
+	// rootfs bind-mount would be.
+	if err := syscall.Mount(shared, bound, "", syscall.MS_BIND, ""); err != nil {
+		t.Fatalf("unexpected error bind mounting: %v", err)
+	}
+	defer syscall.Unmount(bound, syscall.MNT_DETACH)
+
+	rsharedProbe := filepath.Join(shared, "rshared-probe")
+	if err := os.MkdirAll(rsharedProbe, 0755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := syscall.Mount("tmpfs", rsharedProbe, "tmpfs", 0, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer syscall.Unmount(rsharedProbe, syscall.MNT_DETACH)
+
+	if mounted, err := isMountpoint(filepath.Join(bound, "rshared-probe")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if !mounted {
+		t.Error("expected a mount under an rshared mountpoint to propagate into its bind-mounted peer")
+	}
+
+	if err := AdjustMountPropagation(shared, "private"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	privateProbe := filepath.Join(shared, "private-probe")
+	if err := os.MkdirAll(privateProbe, 0755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := syscall.Mount("tmpfs", privateProbe, "tmpfs", 0, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer syscall.Unmount(privateProbe, syscall.MNT_DETACH)
+
+	if mounted, err := isMountpoint(filepath.Join(bound, "private-probe")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if mounted {
+		t.Error("expected a mount under a private mountpoint not to propagate into its bind-mounted peer")
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package common
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/coreos/rkt/Godeps/_workspace/src/github.com/opencontainers/selinux/go-selinux/label"
+
+	"github.com/appc/spec/schema/types"
+)
+
+// volumeRelabelAnnotationPrefix is set per-volume on the pod manifest to
+// request Docker/Podman-style ":z" (shared) or ":Z" (private) relabeling of
+// a bind-mounted volume, e.g. "coreos.com/rkt/stage1/volume-relabel/data"="z".
+const volumeRelabelAnnotationPrefix = "coreos.com/rkt/stage1/volume-relabel/"
+
+// volumeRelabelMode reports whether the given volume requests relabeling
+// and, if so, whether it should use the shared ("z") or private ("Z") MCS
+// category.
+func volumeRelabelMode(annotations types.Annotations, volName types.ACName) (shared bool, ok bool) {
+	v, ok := annotations.Get(types.ACIdentifier(volumeRelabelAnnotationPrefix + volName.String()))
+	if !ok {
+		return false, false
+	}
+	switch v {
+	case "z":
+		return true, true
+	case "Z":
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+// containerFileType is the SELinux type applied to bind-mounted volumes,
+// mirroring what Docker/Podman use for their "z"/"Z" mount flags.
+const containerFileType = "container_file_t"
+
+// volumeRelabeler is the subset of the SELinux labeling API appToNspawnArgs
+// needs; it's an interface so tests can exercise the relabeling logic
+// without requiring SELinux on the CI host.
+type volumeRelabeler interface {
+	SetFileLabel(path, label string) error
+}
+
+// systemVolumeRelabeler calls out to the real SELinux labeling support.
+type systemVolumeRelabeler struct{}
+
+func (systemVolumeRelabeler) SetFileLabel(path, lbl string) error {
+	return label.SetFileLabel(path, lbl)
+}
+
+// defaultVolumeRelabeler is swapped out by tests.
+var defaultVolumeRelabeler volumeRelabeler = systemVolumeRelabeler{}
+
+// noRelabelPaths are paths that must never be relabeled: known kernel
+// filesystems and core system directories whose labels rkt has no business
+// rewriting.
+var noRelabelPaths = map[string]bool{
+	"/":     true,
+	"/usr":  true,
+	"/etc":  true,
+	"/proc": true,
+	"/sys":  true,
+	"/dev":  true,
+}
+
+// sharedMCSCategory and privateMCSCategory derive deterministic SELinux MCS
+// categories from the pod UUID (and, for private volumes, the app name), so
+// that:
+//   - an "empty" volume shared=true between two apps of the same pod ends
+//     up with the same MCS category on both, and
+//   - a shared=false volume gets a per-container unique category.
+func sharedMCSCategory(podUUID string) string {
+	return mcsLabel(podUUID)
+}
+
+func privateMCSCategory(podUUID, appName string) string {
+	return mcsLabel(podUUID + "/" + appName)
+}
+
+func mcsLabel(seed string) string {
+	h := sha256.Sum256([]byte(seed))
+	// SELinux MCS categories range from c0 to c1023.
+	c1 := (int(h[0])<<8 | int(h[1])) % 1024
+	c2 := (int(h[2])<<8 | int(h[3])) % 1024
+	if c1 == c2 {
+		c2 = (c2 + 1) % 1024
+	}
+	if c1 > c2 {
+		c1, c2 = c2, c1
+	}
+	return fmt.Sprintf("s0:c%d,c%d", c1, c2)
+}
+
+// isRelabelDenied reports whether path is one rkt must never relabel: a
+// denylisted system path, or anything under a known kernel filesystem.
+func isRelabelDenied(path string) bool {
+	clean := filepath.Clean(path)
+	if noRelabelPaths[clean] {
+		return true
+	}
+	for _, prefix := range []string{"/proc/", "/sys/", "/dev/"} {
+		if strings.HasPrefix(clean, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isReadOnlyMount reports whether path sits on a filesystem mounted
+// read-only, via statfs(2)'s f_flags. The kernel mirrors the mount's
+// MS_RDONLY bit into f_flags, so checking it against syscall.MS_RDONLY (the
+// syscall package has no separate ST_RDONLY constant) gives the mount's
+// actual read-only status, unlike a file's own permission bits: a writable
+// file on a read-only bind still can't be relabeled, and a read-only-looking
+// file on a writable filesystem still can.
+func isReadOnlyMount(path string) (bool, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return false, err
+	}
+	return st.Flags&syscall.MS_RDONLY != 0, nil
+}
+
+// LabelVolumePath applies an SELinux relabel to path analogous to Docker's
+// ":z" (shared, mcsLabel is shared across containers) and ":Z" (private,
+// mcsLabel is unique to this container) bind-mount semantics. It returns an
+// error for a denylisted path, and is a no-op when path's filesystem is
+// mounted read-only, since relabeling it would fail anyway.
+func LabelVolumePath(r volumeRelabeler, path, mcsLabel string) error {
+	if isRelabelDenied(path) {
+		return fmt.Errorf("refusing to relabel system path %q", path)
+	}
+
+	if ro, err := isReadOnlyMount(path); err == nil && ro {
+		return nil
+	}
+
+	ctx := fmt.Sprintf("system_u:object_r:%s:%s", containerFileType, mcsLabel)
+	return r.SetFileLabel(path, ctx)
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 The rkt Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//+build linux
+
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+)
+
+type fakeRelabeler struct {
+	calls map[string]string
+}
+
+func (f *fakeRelabeler) SetFileLabel(path, label string) error {
+	if f.calls == nil {
+		f.calls = make(map[string]string)
+	}
+	f.calls[path] = label
+	return nil
+}
+
+func TestLabelVolumePathDeniesSystemPaths(t *testing.T) {
+	r := &fakeRelabeler{}
+	for _, p := range []string{"/", "/usr", "/etc", "/sys/fs/cgroup", "/proc/1"} {
+		if err := LabelVolumePath(r, p, "s0:c1,c2"); err == nil {
+			t.Errorf("expected an error relabeling denylisted path %q", p)
+		}
+	}
+}
+
+// TestLabelVolumePathSkipsReadOnlyMount exercises LabelVolumePath against an
+// actually read-only mount, rather than a writable file with restrictive
+// permission bits, since the two aren't the same thing.
+func TestLabelVolumePathSkipsReadOnlyMount(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root to mount a read-only tmpfs")
+	}
+
+	dir, err := ioutil.TempDir("", "rkt-selinux-readonly-test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := syscall.Mount("tmpfs", dir, "tmpfs", syscall.MS_RDONLY, ""); err != nil {
+		t.Skipf("could not mount a read-only tmpfs in this test environment: %v", err)
+	}
+	defer syscall.Unmount(dir, syscall.MNT_DETACH)
+
+	r := &fakeRelabeler{}
+	if err := LabelVolumePath(r, dir, "s0:c1,c2"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, called := r.calls[dir]; called {
+		t.Error("expected no relabel attempt against a read-only mount")
+	}
+}
+
+func TestSharedMCSCategoryStableAcrossApps(t *testing.T) {
+	a := sharedMCSCategory("11111111-2222-3333-4444-555555555555")
+	b := sharedMCSCategory("11111111-2222-3333-4444-555555555555")
+	if a != b {
+		t.Errorf("expected the same pod UUID to always produce the same shared MCS category, got %q and %q", a, b)
+	}
+}
+
+func TestPrivateMCSCategoryUniquePerApp(t *testing.T) {
+	podUUID := "11111111-2222-3333-4444-555555555555"
+	a := privateMCSCategory(podUUID, "app-one")
+	b := privateMCSCategory(podUUID, "app-two")
+	if a == b {
+		t.Errorf("expected distinct apps in the same pod to get distinct private MCS categories, got %q for both", a)
+	}
+}